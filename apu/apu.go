@@ -0,0 +1,219 @@
+package apu
+
+import (
+	"io"
+	"nes-go/emulator"
+)
+
+const (
+	PULSE_1_START  = 0x4000
+	PULSE_2_START  = 0x4004
+	TRIANGLE_START = 0x4008
+	NOISE_START    = 0x400c
+	DMC_START      = 0x4010
+	CHANNELS_END   = 0x4013
+	APU_STATUS     = 0x4015
+
+	CHANNEL_REGISTERS = 4
+
+	// Samples are dropped when nobody drains the buffer, one frame worth
+	MAX_BUFFERED_SAMPLES = 29781
+)
+
+// $4015 flags
+const (
+	STATUS_PULSE_1  byte = 0x01
+	STATUS_PULSE_2  byte = 0x02
+	STATUS_TRIANGLE byte = 0x04
+	STATUS_NOISE    byte = 0x08
+	STATUS_DMC      byte = 0x10
+	STATUS_DMC_IRQ  byte = 0x80
+)
+
+type APU struct {
+	mem *emulator.Memory
+
+	pulse1   Pulse
+	pulse2   Pulse
+	triangle Triangle
+	noise    Noise
+	dmc      DMC
+
+	frameCounter frameCounter
+
+	// CPU cycles since power up
+	cycles uint64
+	// Mixed output, one sample per CPU cycle
+	samples   []float32
+	resampler *Resampler
+	pcm       PcmStream
+}
+
+func NewAPU(memory *emulator.Memory) *APU {
+	apu := &APU{
+		mem:     memory,
+		pulse1:  Pulse{onesComplement: true},
+		noise:   Noise{shift: 1, period: NOISE_PERIODS[0]},
+		dmc:     DMC{mem: memory, period: DMC_RATES[0], bitsRemaining: 8, silence: true},
+		samples: make([]float32, 0, MAX_BUFFERED_SAMPLES),
+	}
+	apu.pcm.apu = apu
+	apu.SetSampleRate(DEFAULT_SAMPLE_RATE)
+
+	// The IO register range is always available, so this can't fail
+	memory.AttachWriteDevice(PULSE_1_START, CHANNELS_END, apu)
+	memory.AttachDevice(APU_STATUS, APU_STATUS, apu)
+	memory.AttachWriteDevice(FRAME_COUNTER, FRAME_COUNTER, apu)
+
+	return apu
+}
+
+// The reset line silences every channel
+func (apu *APU) Reset() {
+	apu.Write(0, APU_STATUS)
+}
+
+// $4015 reports which length counters are still active and the interrupts
+func (apu *APU) Read(address uint16) byte {
+	if address != APU_STATUS {
+		return apu.mem.OpenBus()
+	}
+
+	var status byte
+	if apu.pulse1.length.active() {
+		status |= STATUS_PULSE_1
+	}
+	if apu.pulse2.length.active() {
+		status |= STATUS_PULSE_2
+	}
+	if apu.triangle.length.active() {
+		status |= STATUS_TRIANGLE
+	}
+	if apu.noise.length.active() {
+		status |= STATUS_NOISE
+	}
+	if apu.dmc.active() {
+		status |= STATUS_DMC
+	}
+	if apu.frameCounter.irq {
+		status |= STATUS_FRAME_IRQ
+	}
+	if apu.dmc.irq {
+		status |= STATUS_DMC_IRQ
+	}
+
+	// Reading acknowledges the frame interrupt
+	apu.frameCounter.irq = false
+
+	return status
+}
+
+func (apu *APU) Write(value byte, address uint16) {
+	switch {
+	case address < PULSE_2_START:
+		apu.pulse1.write(value, address-PULSE_1_START)
+	case address < TRIANGLE_START:
+		apu.pulse2.write(value, address-PULSE_2_START)
+	case address < NOISE_START:
+		apu.triangle.write(value, address-TRIANGLE_START)
+	case address < DMC_START:
+		apu.noise.write(value, address-NOISE_START)
+	case address <= CHANNELS_END:
+		apu.dmc.write(value, address-DMC_START)
+	case address == APU_STATUS:
+		apu.pulse1.length.setEnabled(value&STATUS_PULSE_1 != 0)
+		apu.pulse2.length.setEnabled(value&STATUS_PULSE_2 != 0)
+		apu.triangle.length.setEnabled(value&STATUS_TRIANGLE != 0)
+		apu.noise.length.setEnabled(value&STATUS_NOISE != 0)
+		apu.dmc.setEnabled(value&STATUS_DMC != 0)
+	case address == FRAME_COUNTER:
+		apu.writeFrameCounter(value)
+	}
+}
+
+// Advances the APU one CPU cycle
+func (apu *APU) Tick() {
+	apu.triangle.clockTimer()
+	apu.noise.clockTimer()
+	apu.dmc.clockTimer()
+	apu.clockFrameCounter()
+
+	// The pulse timers run at half the CPU rate
+	if apu.cycles%2 == 1 {
+		apu.pulse1.clockTimer()
+		apu.pulse2.clockTimer()
+	}
+
+	apu.cycles++
+
+	sample := apu.mix()
+	if len(apu.samples) < MAX_BUFFERED_SAMPLES {
+		apu.samples = append(apu.samples, sample)
+	}
+	apu.resampler.AddSample(sample)
+}
+
+// Runs the APU until it catches up with the given CPU cycle
+func (apu *APU) CatchUp(cpuCycle uint64) {
+	for apu.cycles < cpuCycle {
+		apu.Tick()
+	}
+}
+
+// Clocks the envelopes and the triangle linear counter
+func (apu *APU) quarterFrame() {
+	apu.pulse1.envelope.clock()
+	apu.pulse2.envelope.clock()
+	apu.noise.envelope.clock()
+	apu.triangle.clockLinearCounter()
+}
+
+// Clocks the length counters and the sweep units
+func (apu *APU) halfFrame() {
+	apu.pulse1.length.clock()
+	apu.pulse2.length.clock()
+	apu.triangle.length.clock()
+	apu.noise.length.clock()
+
+	apu.pulse1.clockSweep()
+	apu.pulse2.clockSweep()
+}
+
+// The IRQ output of the APU
+func (apu *APU) IRQ() bool {
+	return apu.dmc.irq || apu.frameCounter.irq
+}
+
+// Sets the rate of the PCM output, dropping the samples not read yet
+func (apu *APU) SetSampleRate(rate int) {
+	apu.resampler = NewResampler(CPU_CLOCK_RATE, float64(rate))
+	apu.pcm.pending = nil
+}
+
+// Returns the mixer output since the last call, one sample per CPU cycle from 0 to 1
+func (apu *APU) TakeSamples() []float32 {
+	samples := make([]float32, len(apu.samples))
+	copy(samples, apu.samples)
+	apu.samples = apu.samples[:0]
+
+	return samples
+}
+
+// Channels, frame counter and cycle count. Samples not yet resampled are lost
+func (apu *APU) stateFields() []any {
+	fields := append(apu.pulse1.stateFields(), apu.pulse2.stateFields()...)
+	fields = append(fields, apu.triangle.stateFields()...)
+	fields = append(fields, apu.noise.stateFields()...)
+	fields = append(fields, apu.dmc.stateFields()...)
+	fields = append(fields, apu.frameCounter.stateFields()...)
+
+	return append(fields, &apu.cycles)
+}
+
+func (apu *APU) SaveState(w io.Writer) error {
+	return emulator.WriteState(w, apu.stateFields()...)
+}
+
+func (apu *APU) LoadState(r io.Reader) error {
+	return emulator.ReadState(r, apu.stateFields()...)
+}
@@ -0,0 +1,430 @@
+package apu
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"nes-go/emulator"
+	"os"
+	"slices"
+	"testing"
+)
+
+func newTestAPU(t *testing.T) (*APU, *emulator.Memory) {
+	cartridge := make([]byte, emulator.HEADER_SIZE+emulator.PRG_BYTES_UNITS*emulator.BYTES_IN_KILOBYTES)
+	copy(cartridge, emulator.INES_MAGIC)
+	cartridge[4] = 1
+	// DMC sample at $C000
+	copy(cartridge[emulator.HEADER_SIZE:], []byte{0xff, 0x00})
+
+	rom, err := emulator.NewRom(cartridge)
+	assert.Nil(t, err)
+	mem, err := emulator.NewMemory(rom)
+	assert.Nil(t, err)
+
+	return NewAPU(mem), mem
+}
+
+func TestPulseDuty(t *testing.T) {
+	apu, mem := newTestAPU(t)
+	mem.WriteCpu(STATUS_PULSE_1, APU_STATUS)
+	// 25% duty, constant volume 15, period 8
+	mem.WriteCpu(0x7f, 0x4000)
+	mem.WriteCpu(0x08, 0x4002)
+	mem.WriteCpu(0x08, 0x4003)
+
+	// Each step lasts (period + 1) * 2 CPU cycles
+	var outputs []byte
+	for range PULSE_STEPS {
+		outputs = append(outputs, apu.pulse1.output())
+		for range 18 {
+			apu.Tick()
+		}
+	}
+	assert.Equal(t, []byte{0, 15, 15, 0, 0, 0, 0, 0}, outputs)
+
+	samples := apu.TakeSamples()
+	assert.Len(t, samples, PULSE_STEPS*18)
+	assert.Empty(t, apu.TakeSamples())
+	// The idle triangle holds its first step
+	assert.Equal(t, PULSE_TABLE[15]+TND_TABLE[3*15], slices.Max(samples))
+	assert.Equal(t, TND_TABLE[3*15], slices.Min(samples))
+}
+
+func TestLengthCounter(t *testing.T) {
+	apu, mem := newTestAPU(t)
+
+	// Disabled channels ignore the length load
+	mem.WriteCpu(0x08, 0x4003)
+	val, _ := mem.ReadCpu(APU_STATUS)
+	assert.Equal(t, byte(0), val)
+
+	mem.WriteCpu(STATUS_PULSE_2|STATUS_NOISE, APU_STATUS)
+	mem.WriteCpu(0x18, 0x4007)
+	mem.WriteCpu(0x20, 0x400c)
+	mem.WriteCpu(0x18, 0x400f)
+	assert.Equal(t, byte(2), apu.pulse2.length.value)
+
+	val, _ = mem.ReadCpu(APU_STATUS)
+	assert.Equal(t, STATUS_PULSE_2|STATUS_NOISE, val)
+
+	// The noise counter is halted
+	apu.halfFrame()
+	apu.halfFrame()
+	val, _ = mem.ReadCpu(APU_STATUS)
+	assert.Equal(t, STATUS_NOISE, val)
+
+	mem.WriteCpu(0, APU_STATUS)
+	val, _ = mem.ReadCpu(APU_STATUS)
+	assert.Equal(t, byte(0), val)
+}
+
+func TestSweep(t *testing.T) {
+	apu, mem := newTestAPU(t)
+	mem.WriteCpu(STATUS_PULSE_1|STATUS_PULSE_2, APU_STATUS)
+
+	// Negate with a shift of 1
+	for _, start := range []uint16{PULSE_1_START, PULSE_2_START} {
+		mem.WriteCpu(0x89, start+1)
+		mem.WriteCpu(0x00, start+2)
+		mem.WriteCpu(0x01, start+3)
+	}
+
+	// Pulse 1 subtracts one more
+	assert.Equal(t, uint16(0x0100-0x80-1), apu.pulse1.sweepTarget())
+	assert.Equal(t, uint16(0x0100-0x80), apu.pulse2.sweepTarget())
+
+	apu.halfFrame()
+	assert.Equal(t, uint16(0x007f), apu.pulse1.period)
+	assert.Equal(t, uint16(0x0080), apu.pulse2.period)
+
+	// Targets past $7FF mute the channel even with the sweep disabled
+	mem.WriteCpu(0x01, 0x4001)
+	mem.WriteCpu(0xff, 0x4002)
+	mem.WriteCpu(0x07, 0x4003)
+	assert.True(t, apu.pulse1.muted())
+
+	mem.WriteCpu(0x07, 0x4002)
+	mem.WriteCpu(0x00, 0x4003)
+	assert.True(t, apu.pulse1.muted())
+}
+
+func TestEnvelope(t *testing.T) {
+	var env envelope
+	env.write(0x01)
+	env.start = true
+
+	env.clock()
+	assert.Equal(t, byte(15), env.output())
+
+	// The divider has a period of volume + 1
+	for range 2 * 15 {
+		env.clock()
+	}
+	assert.Equal(t, byte(0), env.output())
+
+	env.clock()
+	env.clock()
+	assert.Equal(t, byte(0), env.output())
+
+	env.loop = true
+	env.clock()
+	env.clock()
+	assert.Equal(t, byte(15), env.output())
+
+	env.write(0x17)
+	assert.Equal(t, byte(7), env.output())
+}
+
+func TestTriangle(t *testing.T) {
+	apu, mem := newTestAPU(t)
+	mem.WriteCpu(STATUS_TRIANGLE, APU_STATUS)
+	mem.WriteCpu(0x02, 0x4008)
+	mem.WriteCpu(0x00, 0x400a)
+	mem.WriteCpu(0x08, 0x400b)
+
+	// Nothing moves until the linear counter is reloaded
+	apu.Tick()
+	assert.Equal(t, byte(15), apu.triangle.output())
+
+	apu.quarterFrame()
+	assert.False(t, apu.triangle.linearReload)
+	apu.Tick()
+	apu.Tick()
+	assert.Equal(t, byte(13), apu.triangle.output())
+
+	apu.quarterFrame()
+	apu.quarterFrame()
+	assert.Equal(t, byte(0), apu.triangle.linearCounter)
+
+	// The output holds its level when silenced
+	apu.Tick()
+	assert.Equal(t, byte(13), apu.triangle.output())
+}
+
+func TestNoise(t *testing.T) {
+	noise := Noise{shift: 1}
+
+	noise.clockShift()
+	assert.Equal(t, uint16(0x4000), noise.shift)
+
+	// The long mode repeats every 32767 steps, the short one every 93
+	noise.shift = 1
+	for range 32767 {
+		noise.clockShift()
+	}
+	assert.Equal(t, uint16(1), noise.shift)
+
+	noise.mode = true
+	for range 93 {
+		noise.clockShift()
+	}
+	assert.Equal(t, uint16(1), noise.shift)
+
+	apu, mem := newTestAPU(t)
+	mem.WriteCpu(STATUS_NOISE, APU_STATUS)
+	mem.WriteCpu(0x3a, 0x400c)
+	mem.WriteCpu(0x00, 0x400e)
+	mem.WriteCpu(0x08, 0x400f)
+
+	// Bit 0 of the register silences the output
+	assert.Equal(t, byte(0), apu.noise.output())
+	for range 4 {
+		apu.Tick()
+	}
+	assert.Equal(t, byte(10), apu.noise.output())
+
+	// Before the first $400E write the shortest period is used
+	apu, _ = newTestAPU(t)
+	for range NOISE_PERIODS[0] + 1 {
+		apu.Tick()
+	}
+	assert.Equal(t, uint16(0x2000), apu.noise.shift)
+}
+
+func TestDmc(t *testing.T) {
+	apu, mem := newTestAPU(t)
+	mem.WriteCpu(0x8f, 0x4010)
+	mem.WriteCpu(0x40, 0x4011)
+	mem.WriteCpu(0x00, 0x4012)
+	mem.WriteCpu(0x00, 0x4013)
+
+	// Enabling the channel fetches the first byte right away
+	mem.WriteCpu(STATUS_DMC, APU_STATUS)
+	assert.Equal(t, uint64(DMC_FETCH_CYCLES), mem.StallCycles)
+	assert.Equal(t, byte(0xff), apu.dmc.buffer)
+
+	// The one byte sample has ended, raising the IRQ
+	val, _ := mem.ReadCpu(APU_STATUS)
+	assert.Equal(t, STATUS_DMC_IRQ, val)
+	assert.True(t, apu.IRQ())
+
+	// The first output cycle is silent, the next one plays the byte
+	for range 8 * DMC_RATES[15] {
+		apu.Tick()
+	}
+	assert.Equal(t, byte(0x40), apu.dmc.output())
+	for range 8 * DMC_RATES[15] {
+		apu.Tick()
+	}
+	assert.Equal(t, byte(0x50), apu.dmc.output())
+
+	// Writing $4015 acknowledges the IRQ
+	mem.WriteCpu(0, APU_STATUS)
+	assert.False(t, apu.IRQ())
+}
+
+func TestDmcLoop(t *testing.T) {
+	apu, mem := newTestAPU(t)
+	mem.WriteCpu(0x40, 0x4010)
+	mem.WriteCpu(0x00, 0x4012)
+	mem.WriteCpu(0x01, 0x4013)
+	mem.WriteCpu(STATUS_DMC, APU_STATUS)
+
+	// Enabling fetched the first of the 17 bytes
+	for range 16 {
+		apu.dmc.bufferFull = false
+		apu.dmc.fetch()
+	}
+	assert.False(t, apu.IRQ())
+	assert.Equal(t, uint16(0xc000), apu.dmc.address)
+	assert.Equal(t, uint16(17), apu.dmc.bytesRemaining)
+
+	val, _ := mem.ReadCpu(APU_STATUS)
+	assert.Equal(t, STATUS_DMC, val)
+
+	// Disabling the channel stops the sample
+	mem.WriteCpu(0, APU_STATUS)
+	val, _ = mem.ReadCpu(APU_STATUS)
+	assert.Equal(t, byte(0), val)
+
+	// The address wraps to $8000
+	apu.dmc.address = 0xffff
+	apu.dmc.bytesRemaining = 2
+	apu.dmc.bufferFull = false
+	apu.dmc.fetch()
+	assert.Equal(t, uint16(0x8000), apu.dmc.address)
+}
+
+func TestFrameCounter(t *testing.T) {
+	apu, mem := newTestAPU(t)
+	mem.WriteCpu(STATUS_PULSE_1, APU_STATUS)
+	mem.WriteCpu(0x00, 0x4000)
+	mem.WriteCpu(0x18, 0x4003)
+	assert.Equal(t, byte(2), apu.pulse1.length.value)
+
+	// 4 step mode clocks the length counters twice per sequence
+	apu.CatchUp(FRAME_STEP_2)
+	assert.Equal(t, byte(1), apu.pulse1.length.value)
+	assert.False(t, apu.IRQ())
+
+	apu.CatchUp(FRAME_FOUR_STEP_END)
+	assert.Equal(t, byte(0), apu.pulse1.length.value)
+	assert.True(t, apu.IRQ())
+
+	val, _ := mem.ReadCpu(APU_STATUS)
+	assert.Equal(t, STATUS_FRAME_IRQ, val)
+	assert.False(t, apu.IRQ())
+
+	// The inhibit flag clears the IRQ and keeps it from happening
+	apu.CatchUp(2 * FRAME_FOUR_STEP_END)
+	assert.True(t, apu.IRQ())
+	mem.WriteCpu(FRAME_IRQ_INHIBIT, FRAME_COUNTER)
+	assert.False(t, apu.IRQ())
+	apu.CatchUp(4 * FRAME_FOUR_STEP_END)
+	assert.False(t, apu.IRQ())
+}
+
+func TestFiveStepFrameCounter(t *testing.T) {
+	apu, mem := newTestAPU(t)
+	mem.WriteCpu(STATUS_PULSE_1, APU_STATUS)
+	mem.WriteCpu(0x18, 0x4003)
+
+	// Entering 5 step mode clocks a half frame after the write delay
+	mem.WriteCpu(FRAME_FIVE_STEP, FRAME_COUNTER)
+	apu.CatchUp(4)
+	assert.Equal(t, byte(1), apu.pulse1.length.value)
+
+	start := apu.cycles - apu.frameCounter.cycle
+	apu.CatchUp(start + FRAME_STEP_4 + 1)
+	assert.Equal(t, byte(0), apu.pulse1.length.value)
+	assert.Equal(t, uint64(FRAME_STEP_4+1), apu.frameCounter.cycle)
+
+	apu.CatchUp(start + FRAME_FIVE_STEP_END)
+	assert.Equal(t, uint64(0), apu.frameCounter.cycle)
+	assert.False(t, apu.IRQ())
+}
+
+func TestMixer(t *testing.T) {
+	assert.Equal(t, float32(0), PULSE_TABLE[0])
+	assert.InDelta(t, 0.2575, PULSE_TABLE[30], 0.0001)
+	assert.InDelta(t, 0.7425, TND_TABLE[202], 0.0001)
+}
+
+func TestResampler(t *testing.T) {
+	resampler := NewResampler(CPU_CLOCK_RATE, 44100)
+	resampler.highPassGain = 1
+
+	// A step comes out with its full size, with some ringing
+	for range 1000 {
+		resampler.AddSample(0)
+	}
+	for range 20000 {
+		resampler.AddSample(0.5)
+	}
+
+	samples := resampler.TakeSamples()
+	assert.InDelta(t, 21000*44100/CPU_CLOCK_RATE, len(samples), 1)
+	assert.InDelta(t, 0.5, samples[len(samples)-1], 0.0001)
+	assert.Less(t, slices.Max(samples), float32(0.56))
+	assert.Empty(t, resampler.TakeSamples())
+
+	// The high-pass filter removes the DC offset
+	resampler = NewResampler(CPU_CLOCK_RATE, 44100)
+	for range 40000 {
+		resampler.AddSample(0.5)
+	}
+	samples = resampler.TakeSamples()
+	assert.InDelta(t, 0, samples[len(samples)-1], 0.001)
+
+	// Frequencies above the output Nyquist frequency are filtered out
+	resampler = NewResampler(CPU_CLOCK_RATE, 44100)
+	for i := range 200000 {
+		resampler.AddSample(float32(i / 9 % 2))
+	}
+
+	samples = resampler.TakeSamples()[1000:]
+	assert.Less(t, slices.Max(samples)-slices.Min(samples), float32(0.05))
+}
+
+func TestPcmStream(t *testing.T) {
+	apu, mem := newTestAPU(t)
+	stream := apu.PCM()
+
+	buffer := make([]byte, 64)
+	_, err := stream.Read(buffer)
+	assert.Equal(t, io.EOF, err)
+
+	mem.WriteCpu(STATUS_PULSE_1, APU_STATUS)
+	mem.WriteCpu(0xbf, 0x4000)
+	mem.WriteCpu(0xfd, 0x4002)
+	mem.WriteCpu(0x08, 0x4003)
+	apu.CatchUp(17898)
+
+	data, err := io.ReadAll(stream)
+	assert.Nil(t, err)
+	assert.InDelta(t, DEFAULT_SAMPLE_RATE/100*PCM_SAMPLE_SIZE, len(data), 2*PCM_SAMPLE_SIZE)
+
+	var peak int16
+	for i := 0; i < len(data); i += PCM_SAMPLE_SIZE {
+		peak = max(peak, int16(binary.LittleEndian.Uint16(data[i:])))
+	}
+	assert.Greater(t, peak, int16(1000))
+}
+
+func TestPcmStreamShortReads(t *testing.T) {
+	apu, mem := newTestAPU(t)
+
+	mem.WriteCpu(STATUS_PULSE_1, APU_STATUS)
+	mem.WriteCpu(0xbf, 0x4000)
+	mem.WriteCpu(0xfd, 0x4002)
+	mem.WriteCpu(0x08, 0x4003)
+	apu.CatchUp(17898)
+
+	// Reading a sample at a time, through a new call every time
+	var data []byte
+	buffer := make([]byte, PCM_SAMPLE_SIZE)
+	for {
+		n, err := apu.PCM().Read(buffer)
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		data = append(data, buffer[:n]...)
+	}
+	assert.InDelta(t, DEFAULT_SAMPLE_RATE/100*PCM_SAMPLE_SIZE, len(data), 2*PCM_SAMPLE_SIZE)
+}
+
+func TestWavWriter(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "*.wav")
+	assert.Nil(t, err)
+	defer file.Close()
+
+	wav, err := NewWavWriter(file, 48000)
+	assert.Nil(t, err)
+	wav.Write([]byte{0x01, 0x00, 0xff, 0xff})
+	wav.Write([]byte{0x00, 0x80})
+	assert.Nil(t, wav.Close())
+
+	data, err := os.ReadFile(file.Name())
+	assert.Nil(t, err)
+	assert.Len(t, data, WAV_HEADER_SIZE+6)
+	assert.Equal(t, "RIFF", string(data[0:4]))
+	assert.Equal(t, uint32(WAV_HEADER_SIZE-8+6), binary.LittleEndian.Uint32(data[4:]))
+	assert.Equal(t, "WAVEfmt ", string(data[8:16]))
+	assert.Equal(t, uint32(48000), binary.LittleEndian.Uint32(data[24:]))
+	assert.Equal(t, uint32(96000), binary.LittleEndian.Uint32(data[28:]))
+	assert.Equal(t, "data", string(data[36:40]))
+	assert.Equal(t, uint32(6), binary.LittleEndian.Uint32(data[40:]))
+	assert.Equal(t, []byte{0x01, 0x00, 0xff, 0xff, 0x00, 0x80}, data[WAV_HEADER_SIZE:])
+}
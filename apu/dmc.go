@@ -0,0 +1,172 @@
+package apu
+
+import (
+	"nes-go/emulator"
+)
+
+const (
+	DMC_SAMPLE_START = 0xc000
+	DMC_MAX_LEVEL    = 127
+	// CPU cycles stolen by each sample fetch
+	DMC_FETCH_CYCLES = 4
+)
+
+// NTSC periods of the output unit, in CPU cycles
+var DMC_RATES = [16]uint16{
+	428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54,
+}
+
+/*
+* DMC registers, $4010-$4013:
+*	IL-- RRRR 	IRQ enabled, loop, rate
+*	-DDD DDDD 	Direct load of the output level
+*	AAAA AAAA 	Sample address, $C000 + A * 64
+*	LLLL LLLL 	Sample length, L * 16 + 1 bytes
+ */
+type DMC struct {
+	mem *emulator.Memory
+
+	irqEnabled bool
+	irq        bool
+	loop       bool
+	period     uint16
+	timer      uint16
+
+	sampleAddress uint16
+	sampleLength  uint16
+
+	// Memory reader
+	address        uint16
+	bytesRemaining uint16
+	buffer         byte
+	bufferFull     bool
+
+	// Output unit
+	shift         byte
+	bitsRemaining byte
+	silence       bool
+	level         byte
+}
+
+func (dmc *DMC) write(value byte, register uint16) {
+	switch register {
+	case 0:
+		dmc.irqEnabled = value&0x80 != 0
+		dmc.loop = value&0x40 != 0
+		dmc.period = DMC_RATES[value&0x0f]
+		if !dmc.irqEnabled {
+			dmc.irq = false
+		}
+	case 1:
+		dmc.level = value & 0x7f
+	case 2:
+		dmc.sampleAddress = DMC_SAMPLE_START + uint16(value)*64
+	case 3:
+		dmc.sampleLength = uint16(value)*16 + 1
+	}
+}
+
+func (dmc *DMC) restart() {
+	dmc.address = dmc.sampleAddress
+	dmc.bytesRemaining = dmc.sampleLength
+}
+
+// Bit 4 of $4015 starts the sample if it isn't playing already, or stops it
+func (dmc *DMC) setEnabled(enabled bool) {
+	dmc.irq = false
+
+	if !enabled {
+		dmc.bytesRemaining = 0
+		return
+	}
+
+	if dmc.bytesRemaining == 0 {
+		dmc.restart()
+		dmc.fetch()
+	}
+}
+
+func (dmc *DMC) active() bool {
+	return dmc.bytesRemaining > 0
+}
+
+// Fills the sample buffer from memory, halting the CPU while reading
+func (dmc *DMC) fetch() {
+	if dmc.bufferFull || dmc.bytesRemaining == 0 {
+		return
+	}
+
+	dmc.buffer, _ = dmc.mem.ReadCpu(dmc.address)
+	dmc.bufferFull = true
+	dmc.mem.StallCycles += DMC_FETCH_CYCLES
+
+	// The address wraps to $8000 after $FFFF
+	if dmc.address == 0xffff {
+		dmc.address = emulator.PRG_ROM_START
+	} else {
+		dmc.address++
+	}
+
+	dmc.bytesRemaining--
+	if dmc.bytesRemaining == 0 {
+		if dmc.loop {
+			dmc.restart()
+		} else if dmc.irqEnabled {
+			dmc.irq = true
+		}
+	}
+}
+
+// Clocked every CPU cycle
+func (dmc *DMC) clockTimer() {
+	if dmc.timer > 0 {
+		dmc.timer--
+		return
+	}
+
+	dmc.timer = dmc.period - 1
+	dmc.clockOutput()
+}
+
+// Moves the level up or down by 2 following each bit of the sample
+func (dmc *DMC) clockOutput() {
+	if !dmc.silence {
+		if dmc.shift&1 != 0 {
+			if dmc.level <= DMC_MAX_LEVEL-2 {
+				dmc.level += 2
+			}
+		} else if dmc.level >= 2 {
+			dmc.level -= 2
+		}
+	}
+	dmc.shift >>= 1
+
+	if dmc.bitsRemaining > 0 {
+		dmc.bitsRemaining--
+	}
+	if dmc.bitsRemaining > 0 {
+		return
+	}
+
+	// Start a new output cycle with the next byte of the sample
+	dmc.bitsRemaining = 8
+	dmc.silence = !dmc.bufferFull
+	if dmc.bufferFull {
+		dmc.shift = dmc.buffer
+		dmc.bufferFull = false
+		dmc.fetch()
+	}
+}
+
+func (dmc *DMC) output() byte {
+	return dmc.level
+}
+
+func (dmc *DMC) stateFields() []any {
+	return []any{
+		&dmc.irqEnabled, &dmc.irq, &dmc.loop, &dmc.period, &dmc.timer,
+		&dmc.sampleAddress, &dmc.sampleLength,
+		&dmc.address, &dmc.bytesRemaining, &dmc.buffer, &dmc.bufferFull,
+		&dmc.shift, &dmc.bitsRemaining, &dmc.silence, &dmc.level,
+	}
+}
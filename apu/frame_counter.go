@@ -0,0 +1,105 @@
+package apu
+
+const FRAME_COUNTER = 0x4017
+
+// $4017 flags
+const (
+	FRAME_FIVE_STEP   byte = 0x80
+	FRAME_IRQ_INHIBIT byte = 0x40
+)
+
+const STATUS_FRAME_IRQ byte = 0x40
+
+// NTSC frame sequencer steps, in CPU cycles since the sequence started
+const (
+	FRAME_STEP_1        = 7457
+	FRAME_STEP_2        = 14913
+	FRAME_STEP_3        = 22371
+	FRAME_STEP_4        = 29829
+	FRAME_FOUR_STEP_END = 29830
+	FRAME_STEP_5        = 37281
+	FRAME_FIVE_STEP_END = 37282
+)
+
+/*
+* Frame sequencer, clocking the envelopes, linear counter (quarter frames),
+* length counters and sweeps (half frames):
+*	4 step mode 	Q, Q H, Q, Q H and the frame IRQ
+*	5 step mode 	Q, Q H, Q, -, Q H and no IRQ
+ */
+type frameCounter struct {
+	fiveStep   bool
+	irqInhibit bool
+	irq        bool
+	cycle      uint64
+	// CPU cycles until a write to $4017 restarts the sequence, 0 when none is pending
+	resetDelay byte
+}
+
+func (apu *APU) writeFrameCounter(value byte) {
+	counter := &apu.frameCounter
+	counter.fiveStep = value&FRAME_FIVE_STEP != 0
+	counter.irqInhibit = value&FRAME_IRQ_INHIBIT != 0
+	if counter.irqInhibit {
+		counter.irq = false
+	}
+
+	// The sequence restarts 3 or 4 CPU cycles after the write, to align with the APU cycles
+	counter.resetDelay = 3 + byte(apu.cycles%2)
+}
+
+// Clocked every CPU cycle
+func (apu *APU) clockFrameCounter() {
+	counter := &apu.frameCounter
+
+	if counter.resetDelay > 0 {
+		counter.resetDelay--
+		if counter.resetDelay == 0 {
+			counter.cycle = 0
+			// Entering the 5 step mode clocks the units right away
+			if counter.fiveStep {
+				apu.quarterFrame()
+				apu.halfFrame()
+			}
+			return
+		}
+	}
+
+	counter.cycle++
+
+	switch counter.cycle {
+	case FRAME_STEP_1, FRAME_STEP_3:
+		apu.quarterFrame()
+	case FRAME_STEP_2:
+		apu.quarterFrame()
+		apu.halfFrame()
+	case FRAME_STEP_4 - 1:
+		apu.setFrameIrq()
+	case FRAME_STEP_4:
+		if !counter.fiveStep {
+			apu.quarterFrame()
+			apu.halfFrame()
+			apu.setFrameIrq()
+		}
+	case FRAME_FOUR_STEP_END:
+		if !counter.fiveStep {
+			apu.setFrameIrq()
+			counter.cycle = 0
+		}
+	case FRAME_STEP_5:
+		apu.quarterFrame()
+		apu.halfFrame()
+	case FRAME_FIVE_STEP_END:
+		counter.cycle = 0
+	}
+}
+
+func (apu *APU) setFrameIrq() {
+	if !apu.frameCounter.fiveStep && !apu.frameCounter.irqInhibit {
+		apu.frameCounter.irq = true
+	}
+}
+
+func (counter *frameCounter) stateFields() []any {
+	return []any{&counter.fiveStep, &counter.irqInhibit, &counter.irq, &counter.cycle, &counter.resetDelay}
+}
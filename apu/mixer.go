@@ -0,0 +1,27 @@
+package apu
+
+// Nonlinear mixer, precomputed from the formulas at https://www.nesdev.org/wiki/APU_Mixer
+// The pulse table is indexed by pulse1 + pulse2, and the tnd one by
+// 3 * triangle + 2 * noise + dmc
+var (
+	PULSE_TABLE [31]float32
+	TND_TABLE   [203]float32
+)
+
+func init() {
+	for i := 1; i < len(PULSE_TABLE); i++ {
+		PULSE_TABLE[i] = float32(95.52 / (8128.0/float64(i) + 100))
+	}
+
+	for i := 1; i < len(TND_TABLE); i++ {
+		TND_TABLE[i] = float32(163.67 / (24329.0/float64(i) + 100))
+	}
+}
+
+// Mixed output of the channels, from 0 to about 1
+func (apu *APU) mix() float32 {
+	pulse := PULSE_TABLE[apu.pulse1.output()+apu.pulse2.output()]
+	tnd := TND_TABLE[3*int(apu.triangle.output())+2*int(apu.noise.output())+int(apu.dmc.output())]
+
+	return pulse + tnd
+}
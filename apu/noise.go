@@ -0,0 +1,75 @@
+package apu
+
+// NTSC timer periods of the noise channel, in CPU cycles
+var NOISE_PERIODS = [16]uint16{
+	4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068,
+}
+
+/*
+* Noise registers, $400C-$400F:
+*	--LC VVVV 	Length counter halt / envelope loop, constant volume, volume
+*	---- ---- 	Unused
+*	M--- PPPP 	Mode, period
+*	LLLL L--- 	Length counter load
+ */
+type Noise struct {
+	// Short mode takes the feedback from bit 6 instead of bit 1,
+	// giving a metallic 93 step sequence
+	mode   bool
+	period uint16
+	timer  uint16
+	// 15 bit linear feedback shift register
+	shift uint16
+
+	envelope envelope
+	length   lengthCounter
+}
+
+func (noise *Noise) write(value byte, register uint16) {
+	switch register {
+	case 0:
+		noise.length.halt = value&0x20 != 0
+		noise.envelope.write(value)
+	case 2:
+		noise.mode = value&0x80 != 0
+		noise.period = NOISE_PERIODS[value&0x0f]
+	case 3:
+		noise.length.load(value >> 3)
+		noise.envelope.start = true
+	}
+}
+
+// Clocked every CPU cycle, as the periods are in CPU cycles
+func (noise *Noise) clockTimer() {
+	if noise.timer > 0 {
+		noise.timer--
+		return
+	}
+
+	noise.timer = noise.period - 1
+	noise.clockShift()
+}
+
+func (noise *Noise) clockShift() {
+	tap := 1
+	if noise.mode {
+		tap = 6
+	}
+	feedback := (noise.shift ^ noise.shift>>tap) & 1
+	noise.shift = noise.shift>>1 | feedback<<14
+}
+
+func (noise *Noise) output() byte {
+	if !noise.length.active() || noise.shift&1 != 0 {
+		return 0
+	}
+
+	return noise.envelope.output()
+}
+
+func (noise *Noise) stateFields() []any {
+	fields := []any{&noise.mode, &noise.period, &noise.timer, &noise.shift}
+	fields = append(fields, noise.envelope.stateFields()...)
+
+	return append(fields, noise.length.stateFields()...)
+}
@@ -0,0 +1,45 @@
+package apu
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+const PCM_SAMPLE_SIZE = 2
+
+// Signed 16 bit little endian mono PCM, at the sample rate of the APU.
+// Reads return io.EOF once the emulated samples run out, until more are produced
+type PcmStream struct {
+	apu     *APU
+	pending []float32
+}
+
+// The APU has a single stream, so samples left over by a short read are
+// returned by the next one, whoever makes it
+func (apu *APU) PCM() *PcmStream {
+	return &apu.pcm
+}
+
+func (stream *PcmStream) Read(p []byte) (int, error) {
+	if len(stream.pending) == 0 {
+		stream.pending = stream.apu.resampler.TakeSamples()
+	}
+
+	if len(stream.pending) == 0 {
+		return 0, io.EOF
+	}
+
+	if len(p) < PCM_SAMPLE_SIZE {
+		return 0, io.ErrShortBuffer
+	}
+
+	count := min(len(p)/PCM_SAMPLE_SIZE, len(stream.pending))
+	for i, sample := range stream.pending[:count] {
+		value := max(min(sample*math.MaxInt16, math.MaxInt16), math.MinInt16)
+		binary.LittleEndian.PutUint16(p[i*PCM_SAMPLE_SIZE:], uint16(int16(value)))
+	}
+	stream.pending = stream.pending[count:]
+
+	return count * PCM_SAMPLE_SIZE, nil
+}
@@ -0,0 +1,128 @@
+package apu
+
+const (
+	PULSE_STEPS = 8
+	// Periods below this are silenced by the sweep unit
+	PULSE_MIN_PERIOD = 8
+	PULSE_MAX_PERIOD = 0x7ff
+)
+
+var DUTY_TABLE = [4][PULSE_STEPS]byte{
+	{0, 1, 0, 0, 0, 0, 0, 0},
+	{0, 1, 1, 0, 0, 0, 0, 0},
+	{0, 1, 1, 1, 1, 0, 0, 0},
+	{1, 0, 0, 1, 1, 1, 1, 1},
+}
+
+/*
+* Pulse registers, $4000-$4003 for pulse 1 and $4004-$4007 for pulse 2:
+*	DDLC VVVV 	Duty, length counter halt / envelope loop, constant volume, volume
+*	EPPP NSSS 	Sweep enabled, period, negate, shift
+*	TTTT TTTT 	Timer low
+*	LLLL LTTT 	Length counter load, timer high
+ */
+type Pulse struct {
+	// Pulse 1 negates with the one's complement, pulse 2 with the two's
+	onesComplement bool
+
+	duty   byte
+	step   byte
+	period uint16
+	timer  uint16
+
+	sweepEnabled bool
+	sweepPeriod  byte
+	sweepNegate  bool
+	sweepShift   byte
+	sweepDivider byte
+	sweepReload  bool
+
+	envelope envelope
+	length   lengthCounter
+}
+
+func (pulse *Pulse) write(value byte, register uint16) {
+	switch register {
+	case 0:
+		pulse.duty = value >> 6
+		pulse.length.halt = value&0x20 != 0
+		pulse.envelope.write(value)
+	case 1:
+		pulse.sweepEnabled = value&0x80 != 0
+		pulse.sweepPeriod = (value >> 4) & 0x07
+		pulse.sweepNegate = value&0x08 != 0
+		pulse.sweepShift = value & 0x07
+		pulse.sweepReload = true
+	case 2:
+		pulse.period = pulse.period&0x0700 | uint16(value)
+	case 3:
+		pulse.period = pulse.period&0x00ff | uint16(value&0x07)<<8
+		pulse.length.load(value >> 3)
+		pulse.envelope.start = true
+		pulse.step = 0
+	}
+}
+
+// Clocked every other CPU cycle
+func (pulse *Pulse) clockTimer() {
+	if pulse.timer > 0 {
+		pulse.timer--
+		return
+	}
+
+	pulse.timer = pulse.period
+	pulse.step = (pulse.step + 1) % PULSE_STEPS
+}
+
+// Period the sweep unit is moving to, computed continuously
+func (pulse *Pulse) sweepTarget() uint16 {
+	change := pulse.period >> pulse.sweepShift
+	if !pulse.sweepNegate {
+		return pulse.period + change
+	}
+
+	if pulse.onesComplement {
+		change++
+	}
+	if change > pulse.period {
+		return 0
+	}
+
+	return pulse.period - change
+}
+
+func (pulse *Pulse) muted() bool {
+	return pulse.period < PULSE_MIN_PERIOD || pulse.sweepTarget() > PULSE_MAX_PERIOD
+}
+
+func (pulse *Pulse) clockSweep() {
+	if pulse.sweepDivider == 0 && pulse.sweepEnabled && pulse.sweepShift > 0 && !pulse.muted() {
+		pulse.period = pulse.sweepTarget()
+	}
+
+	if pulse.sweepDivider == 0 || pulse.sweepReload {
+		pulse.sweepDivider = pulse.sweepPeriod
+		pulse.sweepReload = false
+	} else {
+		pulse.sweepDivider--
+	}
+}
+
+func (pulse *Pulse) output() byte {
+	if !pulse.length.active() || pulse.muted() || DUTY_TABLE[pulse.duty][pulse.step] == 0 {
+		return 0
+	}
+
+	return pulse.envelope.output()
+}
+
+func (pulse *Pulse) stateFields() []any {
+	fields := []any{
+		&pulse.duty, &pulse.step, &pulse.period, &pulse.timer,
+		&pulse.sweepEnabled, &pulse.sweepPeriod, &pulse.sweepNegate,
+		&pulse.sweepShift, &pulse.sweepDivider, &pulse.sweepReload,
+	}
+	fields = append(fields, pulse.envelope.stateFields()...)
+
+	return append(fields, pulse.length.stateFields()...)
+}
@@ -0,0 +1,137 @@
+package apu
+
+import (
+	"math"
+)
+
+const (
+	// NTSC CPU clock, the rate of the mixer output
+	CPU_CLOCK_RATE      = 1789773.0
+	DEFAULT_SAMPLE_RATE = 44100
+
+	// Length of the band-limited step, in output samples
+	RESAMPLER_TAPS = 16
+	// Fractional positions the steps are precomputed for
+	RESAMPLER_PHASES = 64
+	// Cutoff of the low-pass filter, relative to the output Nyquist frequency
+	RESAMPLER_CUTOFF = 0.9
+	// High-pass filter removing the DC offset, like the one of the console
+	HIGH_PASS_FREQUENCY = 90.0
+)
+
+/*
+* Band-limited resampler from the CPU clock rate to the host sample rate.
+* The mixer output is a stair of steps, so instead of filtering every input
+* sample only the changes are added, as band-limited impulses of their size.
+* Integrating the output gives the band-limited steps back
+ */
+type Resampler struct {
+	// Output samples per input sample
+	ratio  float64
+	kernel [RESAMPLER_PHASES][RESAMPLER_TAPS]float32
+
+	// Position of the next input sample in deltas, in output samples
+	time   float64
+	last   float32
+	deltas []float32
+
+	integrator   float32
+	highPassIn   float32
+	highPassOut  float32
+	highPassGain float32
+
+	// Samples are dropped when nobody reads them for a second
+	samples     []float32
+	maxBuffered int
+}
+
+func NewResampler(clockRate, sampleRate float64) *Resampler {
+	resampler := &Resampler{
+		ratio:        sampleRate / clockRate,
+		deltas:       make([]float32, RESAMPLER_TAPS),
+		highPassGain: float32(math.Exp(-2 * math.Pi * HIGH_PASS_FREQUENCY / sampleRate)),
+		maxBuffered:  int(sampleRate),
+	}
+
+	// Windowed sinc impulses, centered in the taps and shifted by each phase
+	for phase := range RESAMPLER_PHASES {
+		var sum float64
+		impulse := make([]float64, RESAMPLER_TAPS)
+
+		for tap := range RESAMPLER_TAPS {
+			x := float64(tap) - RESAMPLER_TAPS/2 + 1 - float64(phase)/RESAMPLER_PHASES
+			sinc := 1.0
+			if x != 0 {
+				sinc = math.Sin(math.Pi*x*RESAMPLER_CUTOFF) / (math.Pi * x * RESAMPLER_CUTOFF)
+			}
+			// Blackman window
+			w := 2 * math.Pi * (x + RESAMPLER_TAPS/2) / RESAMPLER_TAPS
+			window := 0.42 - 0.5*math.Cos(w) + 0.08*math.Cos(2*w)
+
+			impulse[tap] = sinc * window
+			sum += impulse[tap]
+		}
+
+		// Each step must add exactly its size once integrated
+		for tap := range RESAMPLER_TAPS {
+			resampler.kernel[phase][tap] = float32(impulse[tap] / sum)
+		}
+	}
+
+	return resampler
+}
+
+// Adds the next input sample, at the clock rate
+func (resampler *Resampler) AddSample(sample float32) {
+	if delta := sample - resampler.last; delta != 0 {
+		resampler.last = sample
+
+		start := int(resampler.time)
+		phase := int((resampler.time - float64(start)) * RESAMPLER_PHASES)
+		for len(resampler.deltas) < start+RESAMPLER_TAPS {
+			resampler.deltas = append(resampler.deltas, 0)
+		}
+
+		for tap, gain := range resampler.kernel[phase] {
+			resampler.deltas[start+tap] += delta * gain
+		}
+	}
+
+	resampler.time += resampler.ratio
+	if resampler.time >= 1 {
+		resampler.flush()
+	}
+}
+
+// Moves the output samples no future step can change to the samples buffer
+func (resampler *Resampler) flush() {
+	ready := int(resampler.time)
+	for len(resampler.deltas) < ready+RESAMPLER_TAPS {
+		resampler.deltas = append(resampler.deltas, 0)
+	}
+
+	for _, delta := range resampler.deltas[:ready] {
+		resampler.integrator += delta
+
+		out := resampler.integrator - resampler.highPassIn + resampler.highPassGain*resampler.highPassOut
+		resampler.highPassIn = resampler.integrator
+		resampler.highPassOut = out
+
+		if len(resampler.samples) < resampler.maxBuffered {
+			resampler.samples = append(resampler.samples, out)
+		}
+	}
+
+	remaining := copy(resampler.deltas, resampler.deltas[ready:])
+	clear(resampler.deltas[remaining:])
+	resampler.deltas = resampler.deltas[:remaining]
+	resampler.time -= float64(ready)
+}
+
+// Returns the output samples produced since the last call
+func (resampler *Resampler) TakeSamples() []float32 {
+	samples := resampler.samples
+	resampler.samples = nil
+
+	return samples
+}
@@ -0,0 +1,82 @@
+package apu
+
+const TRIANGLE_STEPS = 32
+
+var TRIANGLE_SEQUENCE = [TRIANGLE_STEPS]byte{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+/*
+* Triangle registers, $4008-$400B:
+*	CRRR RRRR 	Length counter halt / linear counter control, linear counter load
+*	---- ---- 	Unused
+*	TTTT TTTT 	Timer low
+*	LLLL LTTT 	Length counter load, timer high
+ */
+type Triangle struct {
+	step   byte
+	period uint16
+	timer  uint16
+
+	control       bool
+	linearLoad    byte
+	linearCounter byte
+	linearReload  bool
+
+	length lengthCounter
+}
+
+func (triangle *Triangle) write(value byte, register uint16) {
+	switch register {
+	case 0:
+		triangle.control = value&0x80 != 0
+		triangle.length.halt = triangle.control
+		triangle.linearLoad = value & 0x7f
+	case 2:
+		triangle.period = triangle.period&0x0700 | uint16(value)
+	case 3:
+		triangle.period = triangle.period&0x00ff | uint16(value&0x07)<<8
+		triangle.length.load(value >> 3)
+		triangle.linearReload = true
+	}
+}
+
+// Clocked every CPU cycle. The sequencer only moves while both
+// counters are active, so silencing keeps the last output level
+func (triangle *Triangle) clockTimer() {
+	if triangle.timer > 0 {
+		triangle.timer--
+		return
+	}
+
+	triangle.timer = triangle.period
+	if triangle.length.active() && triangle.linearCounter > 0 {
+		triangle.step = (triangle.step + 1) % TRIANGLE_STEPS
+	}
+}
+
+func (triangle *Triangle) clockLinearCounter() {
+	if triangle.linearReload {
+		triangle.linearCounter = triangle.linearLoad
+	} else if triangle.linearCounter > 0 {
+		triangle.linearCounter--
+	}
+
+	if !triangle.control {
+		triangle.linearReload = false
+	}
+}
+
+func (triangle *Triangle) output() byte {
+	return TRIANGLE_SEQUENCE[triangle.step]
+}
+
+func (triangle *Triangle) stateFields() []any {
+	fields := []any{
+		&triangle.step, &triangle.period, &triangle.timer,
+		&triangle.control, &triangle.linearLoad, &triangle.linearCounter, &triangle.linearReload,
+	}
+
+	return append(fields, triangle.length.stateFields()...)
+}
@@ -0,0 +1,97 @@
+package apu
+
+// Values loaded into the length counters by the upper 5 bits of the
+// fourth register of each channel
+var LENGTH_TABLE = [32]byte{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+// Silences the channel when it reaches 0, clocked by the half frames
+type lengthCounter struct {
+	enabled bool
+	halt    bool
+	value   byte
+}
+
+func (counter *lengthCounter) load(index byte) {
+	if counter.enabled {
+		counter.value = LENGTH_TABLE[index&0x1f]
+	}
+}
+
+func (counter *lengthCounter) setEnabled(enabled bool) {
+	counter.enabled = enabled
+	if !enabled {
+		counter.value = 0
+	}
+}
+
+func (counter *lengthCounter) clock() {
+	if !counter.halt && counter.value > 0 {
+		counter.value--
+	}
+}
+
+func (counter *lengthCounter) active() bool {
+	return counter.value > 0
+}
+
+// Volume of the pulse and noise channels: either a constant volume
+// or a decaying sawtooth, clocked by the quarter frames
+type envelope struct {
+	start    bool
+	loop     bool
+	constant bool
+	// Constant volume, or the period of the divider
+	volume  byte
+	divider byte
+	decay   byte
+}
+
+// Sets the fields of the first register of the pulse and noise channels
+func (env *envelope) write(value byte) {
+	env.loop = value&0x20 != 0
+	env.constant = value&0x10 != 0
+	env.volume = value & 0x0f
+}
+
+func (env *envelope) clock() {
+	if env.start {
+		env.start = false
+		env.decay = 15
+		env.divider = env.volume
+		return
+	}
+
+	if env.divider > 0 {
+		env.divider--
+		return
+	}
+
+	env.divider = env.volume
+	if env.decay > 0 {
+		env.decay--
+	} else if env.loop {
+		env.decay = 15
+	}
+}
+
+func (env *envelope) output() byte {
+	if env.constant {
+		return env.volume
+	}
+
+	return env.decay
+}
+
+func (counter *lengthCounter) stateFields() []any {
+	return []any{&counter.enabled, &counter.halt, &counter.value}
+}
+
+func (envelope *envelope) stateFields() []any {
+	return []any{
+		&envelope.start, &envelope.loop, &envelope.constant,
+		&envelope.volume, &envelope.divider, &envelope.decay,
+	}
+}
@@ -0,0 +1,80 @@
+package apu
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const (
+	WAV_HEADER_SIZE     = 44
+	WAV_FORMAT_PCM      = 1
+	WAV_CHANNELS        = 1
+	WAV_BITS_PER_SAMPLE = 16
+)
+
+// Writes the PCM stream as a WAV file. The header is written first with empty
+// sizes, which are filled by Close once the length of the data is known
+type WavWriter struct {
+	w    io.WriteSeeker
+	size uint32
+}
+
+func NewWavWriter(w io.WriteSeeker, sampleRate int) (*WavWriter, error) {
+	writer := &WavWriter{w: w}
+	if err := writer.writeHeader(uint32(sampleRate)); err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+func (writer *WavWriter) writeHeader(sampleRate uint32) error {
+	blockAlign := uint16(WAV_CHANNELS * WAV_BITS_PER_SAMPLE / 8)
+
+	header := make([]byte, 0, WAV_HEADER_SIZE)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, 0)
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)
+	header = binary.LittleEndian.AppendUint16(header, WAV_FORMAT_PCM)
+	header = binary.LittleEndian.AppendUint16(header, WAV_CHANNELS)
+	header = binary.LittleEndian.AppendUint32(header, sampleRate)
+	header = binary.LittleEndian.AppendUint32(header, sampleRate*uint32(blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, blockAlign)
+	header = binary.LittleEndian.AppendUint16(header, WAV_BITS_PER_SAMPLE)
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, 0)
+
+	_, err := writer.w.Write(header)
+	return err
+}
+
+func (writer *WavWriter) Write(p []byte) (int, error) {
+	n, err := writer.w.Write(p)
+	writer.size += uint32(n)
+
+	return n, err
+}
+
+// Fills the sizes of the header. The underlying writer is left open
+func (writer *WavWriter) Close() error {
+	sizes := []struct {
+		offset int64
+		value  uint32
+	}{
+		{4, WAV_HEADER_SIZE - 8 + writer.size},
+		{WAV_HEADER_SIZE - 4, writer.size},
+	}
+
+	for _, size := range sizes {
+		if _, err := writer.w.Seek(size.offset, io.SeekStart); err != nil {
+			return err
+		}
+		if err := binary.Write(writer.w, binary.LittleEndian, size.value); err != nil {
+			return err
+		}
+	}
+
+	_, err := writer.w.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,214 @@
+package console
+
+import (
+	"crypto/sha256"
+	"image"
+	"io"
+	"nes-go/apu"
+	"nes-go/controller"
+	"nes-go/emulator"
+	"nes-go/mos6502"
+	"nes-go/ppu"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+const SAVE_EXTENSION = ".sav"
+
+// The whole machine: cartridge, bus, CPU, PPU, APU and controllers, clocked together
+type Console struct {
+	Rom *emulator.Rom
+	Mem *emulator.Memory
+	Cpu *mos6502.CPU
+	Ppu *ppu.PPU
+	Apu *apu.APU
+
+	Ports *controller.Ports
+	// Standard controllers plugged in by default, one per port
+	Controllers [controller.PORTS_COUNT]*controller.StandardController
+
+	// Battery save file, empty when the cartridge wasn't loaded from a file
+	savePath   string
+	sampleRate int
+	// Nil unless EnableRewind was called
+	rewind *rewindBuffer
+	// Set by Stop, from any goroutine
+	stopped atomic.Bool
+}
+
+func New(cartridge []byte) (*Console, error) {
+	rom, err := emulator.NewRom(cartridge)
+	if err != nil {
+		return nil, err
+	}
+
+	console := &Console{Rom: rom, sampleRate: apu.DEFAULT_SAMPLE_RATE}
+	if err := console.powerOn(); err != nil {
+		return nil, err
+	}
+
+	return console, nil
+}
+
+// Loads a cartridge file, restoring its battery save from a .sav file next to it
+func LoadROM(path string) (*Console, error) {
+	cartridge, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	console, err := New(cartridge)
+	if err != nil {
+		return nil, err
+	}
+
+	console.savePath = strings.TrimSuffix(path, filepath.Ext(path)) + SAVE_EXTENSION
+	if err := emulator.LoadBatterySave(console.Mem.Mapper, console.savePath); err != nil {
+		return nil, err
+	}
+
+	return console, nil
+}
+
+func (console *Console) powerOn() error {
+	mem, err := emulator.NewMemory(console.Rom)
+	if err != nil {
+		return err
+	}
+
+	console.Mem = mem
+	console.Ppu = ppu.NewPPU(mem)
+	console.Apu = apu.NewAPU(mem)
+	console.Apu.SetSampleRate(console.sampleRate)
+
+	console.Ports = controller.NewPorts(mem)
+	for port := range console.Controllers {
+		console.Controllers[port] = controller.NewStandardController()
+		console.Ports.Connect(port, console.Controllers[port])
+	}
+	console.Cpu = mos6502.NewCPUFromReset(mem)
+
+	return nil
+}
+
+// Writes the battery backed RAM of the cartridge to its .sav file
+func (console *Console) SaveBattery() error {
+	if console.savePath == "" {
+		return nil
+	}
+
+	return emulator.WriteBatterySave(console.Mem.Mapper, console.savePath)
+}
+
+// Presses the reset button: RAM and the cartridge keep their contents
+func (console *Console) Reset() {
+	console.Cpu.Reset()
+	console.Ppu.Reset()
+	console.Apu.Reset()
+}
+
+// Turns the console off and on again. Only the battery backed RAM survives
+func (console *Console) PowerCycle() error {
+	var battery []byte
+	if saved, ok := console.Mem.Mapper.(emulator.BatteryBacked); ok {
+		battery = saved.BatteryRam()
+	}
+
+	if err := console.powerOn(); err != nil {
+		return err
+	}
+
+	if saved, ok := console.Mem.Mapper.(emulator.BatteryBacked); ok {
+		copy(saved.BatteryRam(), battery)
+	}
+
+	return nil
+}
+
+// Runs one CPU instruction, or interrupt, and catches up the PPU and APU with it.
+// The interrupt lines are polled afterwards, so they're seen by the next one
+func (console *Console) StepInstruction() {
+	frame := console.Ppu.FrameCount()
+
+	console.Cpu.Step()
+	console.Ppu.CatchUp(console.Cpu.Cycles)
+	console.Apu.CatchUp(console.Cpu.Cycles)
+
+	console.Cpu.SetNMI(console.Ppu.NMI())
+	console.Cpu.SetIRQ(console.Mem.Mapper.IRQ() || console.Apu.IRQ())
+
+	if console.rewind != nil && console.Ppu.FrameCount() != frame {
+		console.recordRewind()
+	}
+}
+
+// Holds the buttons of the standard controller of a port, 0 or 1
+func (console *Console) SetButtons(port int, buttons controller.Buttons) {
+	console.Controllers[port].SetButtons(buttons)
+}
+
+// Runs until the PPU finishes drawing the next frame, or the CPU halts
+func (console *Console) StepFrame() {
+	frame := console.Ppu.FrameCount()
+	for console.Ppu.FrameCount() == frame && !console.Cpu.Halted() {
+		console.StepInstruction()
+	}
+}
+
+func (console *Console) RunFrames(n int) {
+	for range n {
+		console.StepFrame()
+	}
+}
+
+// Runs until a JAM opcode halts the CPU, or Stop is called
+func (console *Console) Run() {
+	for !console.Cpu.Halted() && !console.Stopped() {
+		console.StepInstruction()
+	}
+}
+
+// Makes Run return after the current instruction. It's safe to call from
+// another goroutine, like a signal handler
+func (console *Console) Stop() {
+	console.stopped.Store(true)
+}
+
+func (console *Console) Stopped() bool {
+	return console.stopped.Load()
+}
+
+// Last frame drawn by the PPU
+func (console *Console) Frame() *image.RGBA {
+	return console.Ppu.Frame()
+}
+
+// Hash of the last frame and the internal RAM, the same on every run
+// with the same input
+func (console *Console) Hash() [sha256.Size]byte {
+	hash := sha256.New()
+	hash.Write(console.Ppu.Frame().Pix)
+	hash.Write(console.Mem.CPUData[:])
+
+	var sum [sha256.Size]byte
+	copy(sum[:], hash.Sum(nil))
+	return sum
+}
+
+// Sets the sample rate of the audio output, like 44100 or 48000
+func (console *Console) SetSampleRate(rate int) {
+	console.sampleRate = rate
+	console.Apu.SetSampleRate(rate)
+}
+
+func (console *Console) SampleRate() int {
+	return console.sampleRate
+}
+
+// Audio produced since the last read, as signed 16 bit little endian mono PCM.
+// Reads return io.EOF when it runs out, until more frames are run
+func (console *Console) Audio() io.Reader {
+	return console.Apu.PCM()
+}
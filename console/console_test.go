@@ -0,0 +1,357 @@
+package console
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"nes-go/controller"
+	"nes-go/emulator"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const NMI_COUNTER = 0x10
+
+// One bank of PRG ROM with a program that enables the vblank NMI and loops,
+// counting the NMIs in RAM
+func newTestCartridge(mapperId byte, battery bool) []byte {
+	header := []byte{'N', 'E', 'S', 0x1a, 1, 0, mapperId << 4, mapperId & 0xf0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if battery {
+		header[6] |= 0x02
+	}
+
+	prg := make([]byte, emulator.PRG_BYTES_UNITS*emulator.BYTES_IN_KILOBYTES)
+	copy(prg, []byte{
+		0xa9, 0x80, // LDA #$80
+		0x8d, 0x00, 0x20, // STA $2000
+		0x4c, 0x05, 0x80, // JMP $8005
+	})
+	copy(prg[0x10:], []byte{
+		0xe6, NMI_COUNTER, // INC $10
+		0x40, // RTI
+	})
+
+	// NMI, reset and IRQ vectors
+	copy(prg[0x3ffa:], []byte{0x10, 0x80, 0x00, 0x80, 0x00, 0x80})
+
+	return append(header, prg...)
+}
+
+func newTestConsole(t *testing.T) *Console {
+	nes, err := New(newTestCartridge(0, false))
+	assert.Nil(t, err)
+
+	return nes
+}
+
+func TestStepFrame(t *testing.T) {
+	nes := newTestConsole(t)
+	assert.Equal(t, uint16(0x8000), nes.Cpu.Pc)
+
+	nes.StepFrame()
+	assert.Equal(t, uint64(1), nes.Ppu.FrameCount())
+	assert.Equal(t, byte(0), nes.Mem.CPUData[NMI_COUNTER])
+
+	// The vblank NMI happens right after each frame is drawn
+	nes.RunFrames(3)
+	assert.Equal(t, uint64(4), nes.Ppu.FrameCount())
+	assert.Equal(t, byte(3), nes.Mem.CPUData[NMI_COUNTER])
+
+	// The PPU runs 3 dots per CPU cycle
+	assert.InDelta(t, nes.Cpu.Cycles*3, nes.Mem.PpuCycle, 3)
+}
+
+func TestStepInstruction(t *testing.T) {
+	nes := newTestConsole(t)
+	cycles := nes.Cpu.Cycles
+
+	nes.StepInstruction()
+	assert.Equal(t, uint16(0x8002), nes.Cpu.Pc)
+	assert.Equal(t, cycles+2, nes.Cpu.Cycles)
+}
+
+func TestReset(t *testing.T) {
+	nes := newTestConsole(t)
+	nes.RunFrames(2)
+	nes.Mem.CPUData[0x20] = 0x55
+
+	nes.Reset()
+	assert.Equal(t, uint16(0x8000), nes.Cpu.Pc)
+	assert.Equal(t, byte(0x55), nes.Mem.CPUData[0x20])
+
+	// NMIs are disabled until the program enables them again
+	assert.Equal(t, byte(0), nes.Ppu.GetPPUCTRLReg())
+	nes.RunFrames(2)
+	assert.Equal(t, byte(0x80), nes.Ppu.GetPPUCTRLReg())
+
+	assert.Nil(t, nes.PowerCycle())
+	assert.Equal(t, uint16(0x8000), nes.Cpu.Pc)
+	assert.Equal(t, byte(0), nes.Mem.CPUData[0x20])
+	assert.Equal(t, uint64(0), nes.Ppu.FrameCount())
+}
+
+func TestBatterySave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.nes")
+	assert.Nil(t, os.WriteFile(path, newTestCartridge(1, true), 0644))
+
+	nes, err := LoadROM(path)
+	assert.Nil(t, err)
+	nes.Mem.WriteCpu(0x42, 0x6000)
+
+	// Battery backed RAM survives power cycles
+	assert.Nil(t, nes.PowerCycle())
+	val, _ := nes.Mem.ReadCpu(0x6000)
+	assert.Equal(t, byte(0x42), val)
+
+	assert.Nil(t, nes.SaveBattery())
+	_, err = os.Stat(filepath.Join(filepath.Dir(path), "game.sav"))
+	assert.Nil(t, err)
+
+	nes, err = LoadROM(path)
+	assert.Nil(t, err)
+	val, _ = nes.Mem.ReadCpu(0x6000)
+	assert.Equal(t, byte(0x42), val)
+}
+
+func TestInvalidRom(t *testing.T) {
+	_, err := New([]byte("not a rom"))
+	assert.NotNil(t, err)
+
+	_, err = LoadROM(filepath.Join(t.TempDir(), "missing.nes"))
+	assert.NotNil(t, err)
+}
+
+func TestJam(t *testing.T) {
+	cartridge := newTestCartridge(0, false)
+	cartridge[emulator.HEADER_SIZE] = 0x02 // JAM
+
+	nes, err := New(cartridge)
+	assert.Nil(t, err)
+
+	// Frames stop when the CPU halts
+	nes.RunFrames(2)
+	assert.True(t, nes.Cpu.Halted())
+	assert.Equal(t, uint64(0), nes.Ppu.FrameCount())
+}
+
+func TestStop(t *testing.T) {
+	nes := newTestConsole(t)
+
+	// Run only returns for a JAM, or when stopped from another goroutine
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		nes.Stop()
+	}()
+	nes.Run()
+
+	assert.True(t, nes.Stopped())
+	assert.False(t, nes.Cpu.Halted())
+}
+
+func TestAudio(t *testing.T) {
+	nes := newTestConsole(t)
+	nes.SetSampleRate(48000)
+	nes.RunFrames(60)
+
+	// Samples left by a short read aren't lost
+	first := make([]byte, 100)
+	n, err := nes.Audio().Read(first)
+	assert.Nil(t, err)
+
+	// About a second of 16 bit samples
+	data, err := io.ReadAll(nes.Audio())
+	assert.Nil(t, err)
+	assert.InDelta(t, 2*48000, n+len(data), 2*48000/50)
+
+	data, err = io.ReadAll(nes.Audio())
+	assert.Nil(t, err)
+	assert.Empty(t, data)
+}
+
+func TestControllers(t *testing.T) {
+	nes := newTestConsole(t)
+	nes.SetButtons(1, controller.BUTTON_B)
+
+	nes.Mem.WriteCpu(1, controller.PORT_1)
+	nes.Mem.WriteCpu(0, controller.PORT_1)
+
+	first, _ := nes.Mem.ReadCpu(controller.PORT_2)
+	second, _ := nes.Mem.ReadCpu(controller.PORT_2)
+	assert.Equal(t, byte(0), first&1)
+	assert.Equal(t, byte(1), second&1)
+}
+
+func TestSaveState(t *testing.T) {
+	nes := newTestConsole(t)
+	nes.RunFrames(5)
+	// Save in the middle of a frame
+	for range 1000 {
+		nes.StepInstruction()
+	}
+
+	var state bytes.Buffer
+	assert.Nil(t, nes.SaveState(&state))
+	saved := state.Bytes()
+
+	nes.RunFrames(10)
+	cycles := nes.Cpu.Cycles
+	ram := nes.Mem.CPUData
+	frame := bytes.Clone(nes.Frame().Pix)
+
+	assert.Nil(t, nes.LoadState(bytes.NewReader(saved)))
+	assert.Equal(t, byte(5), nes.Mem.CPUData[NMI_COUNTER])
+
+	nes.RunFrames(10)
+	assert.Equal(t, cycles, nes.Cpu.Cycles)
+	assert.Equal(t, ram, nes.Mem.CPUData)
+	assert.Equal(t, frame, nes.Frame().Pix)
+
+	// Saving again gives back the same state
+	var again bytes.Buffer
+	assert.Nil(t, nes.LoadState(bytes.NewReader(saved)))
+	assert.Nil(t, nes.SaveState(&again))
+	assert.Equal(t, saved, again.Bytes())
+}
+
+func TestLoadInvalidState(t *testing.T) {
+	nes := newTestConsole(t)
+
+	var state bytes.Buffer
+	assert.Nil(t, nes.SaveState(&state))
+	saved := state.Bytes()
+
+	// A different cartridge
+	cartridge := newTestCartridge(0, false)
+	cartridge[emulator.HEADER_SIZE+0x100] = 0xea
+	other, err := New(cartridge)
+	assert.Nil(t, err)
+	assert.ErrorContains(t, other.LoadState(bytes.NewReader(saved)), "different rom")
+
+	nes.RunFrames(2)
+	cycles := nes.Cpu.Cycles
+
+	truncated := saved[:len(saved)-1]
+	assert.NotNil(t, nes.LoadState(bytes.NewReader(truncated)))
+
+	newer := bytes.Clone(saved)
+	newer[len(STATE_MAGIC)]++
+	assert.ErrorContains(t, nes.LoadState(bytes.NewReader(newer)), "version")
+
+	assert.ErrorContains(t, nes.LoadState(bytes.NewReader([]byte("NES\x1a"))), "invalid save state")
+
+	// Rejected states don't change the machine
+	assert.Equal(t, cycles, nes.Cpu.Cycles)
+}
+
+func TestRewind(t *testing.T) {
+	nes := newTestConsole(t)
+	assert.NotNil(t, nes.Rewind(1))
+
+	nes.EnableRewind(100)
+	start := nes.Cpu.Cycles
+
+	var cycles []uint64
+	for range 10 {
+		nes.StepFrame()
+		cycles = append(cycles, nes.Cpu.Cycles)
+	}
+
+	assert.Nil(t, nes.Rewind(3))
+	assert.Equal(t, uint64(7), nes.Ppu.FrameCount())
+	assert.Equal(t, cycles[6], nes.Cpu.Cycles)
+	assert.Equal(t, byte(6), nes.Mem.CPUData[NMI_COUNTER])
+
+	nes.RunFrames(3)
+	assert.Equal(t, cycles[9], nes.Cpu.Cycles)
+
+	// Back to the start of a frame partly run
+	nes.StepInstruction()
+	assert.Nil(t, nes.Rewind(1))
+	assert.Equal(t, cycles[9], nes.Cpu.Cycles)
+
+	// Back to power on, as far as it goes
+	assert.Nil(t, nes.Rewind(1000))
+	assert.Equal(t, start, nes.Cpu.Cycles)
+	assert.Equal(t, uint64(0), nes.Ppu.FrameCount())
+}
+
+func TestRewindBufferWraps(t *testing.T) {
+	nes := newTestConsole(t)
+	nes.EnableRewind(5)
+
+	nes.RunFrames(2*REWIND_KEYFRAME_INTERVAL + 30)
+	assert.Nil(t, nes.Rewind(100))
+	assert.Equal(t, uint64(2*REWIND_KEYFRAME_INTERVAL+26), nes.Ppu.FrameCount())
+
+	// Only the oldest snapshot is left
+	assert.Nil(t, nes.Rewind(1))
+	assert.Equal(t, uint64(2*REWIND_KEYFRAME_INTERVAL+26), nes.Ppu.FrameCount())
+}
+
+func TestHash(t *testing.T) {
+	nes := newTestConsole(t)
+	other := newTestConsole(t)
+	nes.RunFrames(3)
+	other.RunFrames(3)
+	assert.Equal(t, nes.Hash(), other.Hash())
+
+	other.Mem.CPUData[0x0700] = 1
+	assert.NotEqual(t, nes.Hash(), other.Hash())
+}
+
+const MMC3_IRQ_COUNTER = 0x12
+
+// MMC3 cartridge that renders the background from $0000 and the sprites
+// from $1000, with the scanline IRQ every 32 lines counted in RAM. The APU
+// frame IRQ is inhibited, so it's the only IRQ source
+func newMMC3IrqConsole(t *testing.T) *Console {
+	cartridge := newTestCartridge(4, false)
+	prg := cartridge[emulator.HEADER_SIZE:]
+
+	copy(prg, []byte{
+		0xa9, 0x40, // LDA #$40
+		0x8d, 0x17, 0x40, // STA $4017
+		0xa9, 0x1e, // LDA #$1E
+		0x8d, 0x01, 0x20, // STA $2001
+		0xa9, 0x08, // LDA #$08
+		0x8d, 0x00, 0x20, // STA $2000
+		0xa9, 0x20, // LDA #$20
+		0x8d, 0x00, 0xc0, // STA $C000
+		0x8d, 0x01, 0xc0, // STA $C001
+		0x8d, 0x01, 0xe0, // STA $E001
+		0x58,             // CLI
+		0x4c, 0x1b, 0x80, // JMP $801B
+	})
+	copy(prg[0x20:], []byte{
+		0x8d, 0x00, 0xe0, // STA $E000
+		0x8d, 0x01, 0xe0, // STA $E001
+		0xe6, MMC3_IRQ_COUNTER, // INC $12
+		0x40, // RTI
+	})
+	copy(prg[0x3ffe:], []byte{0x20, 0x80})
+
+	nes, err := New(cartridge)
+	assert.Nil(t, err)
+
+	return nes
+}
+
+func TestMMC3Irq(t *testing.T) {
+	nes := newMMC3IrqConsole(t)
+
+	var scanlines []int
+	for nes.Ppu.FrameCount() < 2 {
+		pending := nes.Mem.Mapper.IRQ()
+		nes.StepInstruction()
+		if nes.Mem.Mapper.IRQ() && !pending {
+			scanlines = append(scanlines, nes.Ppu.Scanline())
+		}
+	}
+
+	// The counter is reloaded with 32 on the pre-render line and reaches 0
+	// on scanline 31. The pre-render line of the second frame clocks it too
+	assert.Equal(t, []int{31, 64, 97, 130, 163, 196, 229, 21, 54, 87, 120, 153, 186, 219}, scanlines)
+	assert.Equal(t, byte(len(scanlines)), nes.Mem.CPUData[MMC3_IRQ_COUNTER])
+}
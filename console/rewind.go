@@ -0,0 +1,166 @@
+package console
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+const (
+	// Frames between full snapshots, the ones in between are stored as
+	// deltas against the last one
+	REWIND_KEYFRAME_INTERVAL = 60
+	// Five minutes at 60 frames per second
+	DEFAULT_REWIND_FRAMES = 5 * 60 * 60
+)
+
+// Compressed full state, shared by the deltas that follow it
+type rewindKeyframe struct {
+	data []byte
+}
+
+type rewindSnapshot struct {
+	keyframe *rewindKeyframe
+	// Compressed XOR of the state with the keyframe, mostly zeros
+	delta []byte
+}
+
+// Ring buffer with the state at the end of the last frames. Old keyframes
+// are freed once the last delta using them is overwritten
+type rewindBuffer struct {
+	snapshots []rewindSnapshot
+	start     int
+	count     int
+
+	keyframe      *rewindKeyframe
+	keyframeState []byte
+	sinceKeyframe int
+	// CPU cycle of the last snapshot, to tell if a frame was partly run since
+	cycles uint64
+
+	compressor *flate.Writer
+}
+
+func newRewindBuffer(frames int) *rewindBuffer {
+	// BestSpeed is always a valid level, so this can't fail
+	compressor, _ := flate.NewWriter(io.Discard, flate.BestSpeed)
+
+	return &rewindBuffer{
+		snapshots:  make([]rewindSnapshot, frames),
+		compressor: compressor,
+	}
+}
+
+func (buffer *rewindBuffer) compress(data []byte) []byte {
+	var compressed bytes.Buffer
+	buffer.compressor.Reset(&compressed)
+	// Writes to memory can't fail
+	buffer.compressor.Write(data)
+	buffer.compressor.Close()
+
+	// Without the spare capacity of the buffer
+	return bytes.Clone(compressed.Bytes())
+}
+
+func decompress(data []byte, size int) ([]byte, error) {
+	decompressed := make([]byte, size)
+	_, err := io.ReadFull(flate.NewReader(bytes.NewReader(data)), decompressed)
+
+	return decompressed, err
+}
+
+func xorBytes(dst, a, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
+
+func (buffer *rewindBuffer) push(state []byte) {
+	if buffer.keyframe == nil || buffer.sinceKeyframe == REWIND_KEYFRAME_INTERVAL {
+		buffer.keyframe = &rewindKeyframe{data: buffer.compress(state)}
+		buffer.keyframeState = bytes.Clone(state)
+		buffer.sinceKeyframe = 0
+	}
+	buffer.sinceKeyframe++
+
+	delta := make([]byte, len(state))
+	xorBytes(delta, state, buffer.keyframeState)
+	snapshot := rewindSnapshot{keyframe: buffer.keyframe, delta: buffer.compress(delta)}
+
+	if buffer.count < len(buffer.snapshots) {
+		buffer.snapshots[(buffer.start+buffer.count)%len(buffer.snapshots)] = snapshot
+		buffer.count++
+	} else {
+		buffer.snapshots[buffer.start] = snapshot
+		buffer.start = (buffer.start + 1) % len(buffer.snapshots)
+	}
+}
+
+// Drops the last frames snapshots and returns the state before them,
+// or the oldest one when there aren't as many
+func (buffer *rewindBuffer) rewind(frames int) ([]byte, error) {
+	if buffer.count == 0 {
+		return nil, fmt.Errorf("nothing to rewind")
+	}
+
+	buffer.count = max(buffer.count-frames, 1)
+	snapshot := buffer.snapshots[(buffer.start+buffer.count-1)%len(buffer.snapshots)]
+
+	keyframe, err := decompress(snapshot.keyframe.data, len(buffer.keyframeState))
+	if err != nil {
+		return nil, err
+	}
+	state, err := decompress(snapshot.delta, len(keyframe))
+	if err != nil {
+		return nil, err
+	}
+	xorBytes(state, state, keyframe)
+
+	// The next snapshot starts a new keyframe, the last one may be gone
+	buffer.keyframe = nil
+
+	return state, nil
+}
+
+// Keeps the state of the last frames so they can be rewound, 0 turns it off
+func (console *Console) EnableRewind(frames int) {
+	console.rewind = nil
+	if frames > 0 {
+		console.rewind = newRewindBuffer(frames)
+		console.recordRewind()
+	}
+}
+
+func (console *Console) recordRewind() {
+	var state bytes.Buffer
+	// Writes to memory can't fail
+	console.SaveState(&state)
+	console.rewind.push(state.Bytes())
+	console.rewind.cycles = console.Cpu.Cycles
+}
+
+// Goes back to the state at the end of the frame the given number of frames
+// ago, or as far back as the rewind buffer goes. A frame partly run counts
+// as one, rewinding to its start
+func (console *Console) Rewind(frames int) error {
+	if console.rewind == nil {
+		return fmt.Errorf("rewind not enabled")
+	}
+
+	if console.Cpu.Cycles != console.rewind.cycles {
+		frames--
+	}
+
+	state, err := console.rewind.rewind(frames)
+	if err != nil {
+		return err
+	}
+
+	if err := console.LoadState(bytes.NewReader(state)); err != nil {
+		return err
+	}
+
+	console.rewind.cycles = console.Cpu.Cycles
+	return nil
+}
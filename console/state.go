@@ -0,0 +1,137 @@
+package console
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	STATE_MAGIC = "NESGOSAV"
+	// Bumped whenever the saved fields change, old states are rejected
+	STATE_VERSION uint32 = 1
+)
+
+/*
+ *	Offset	Size	Description
+ *	0		8		Magic "NESGOSAV"
+ *	8		4		Format version, little endian
+ *	12		32		SHA-256 of the PRG and CHR ROM
+ *	44		...		CPU, memory and mapper, PPU, APU and controllers
+ */
+type stateHeader struct {
+	Magic   [len(STATE_MAGIC)]byte
+	Version uint32
+	RomHash [sha256.Size]byte
+}
+
+func (console *Console) romHash() [sha256.Size]byte {
+	hash := sha256.New()
+	hash.Write(console.Rom.PrgData)
+	hash.Write(console.Rom.ChrData)
+
+	var sum [sha256.Size]byte
+	copy(sum[:], hash.Sum(nil))
+	return sum
+}
+
+func (console *Console) writeComponents(w io.Writer) error {
+	if err := console.Cpu.SaveState(w); err != nil {
+		return err
+	}
+	if err := console.Mem.SaveState(w); err != nil {
+		return err
+	}
+	if err := console.Ppu.SaveState(w); err != nil {
+		return err
+	}
+	if err := console.Apu.SaveState(w); err != nil {
+		return err
+	}
+
+	for _, controller := range console.Controllers {
+		if err := controller.SaveState(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (console *Console) readComponents(r io.Reader) error {
+	if err := console.Cpu.LoadState(r); err != nil {
+		return err
+	}
+	if err := console.Mem.LoadState(r); err != nil {
+		return err
+	}
+	if err := console.Ppu.LoadState(r); err != nil {
+		return err
+	}
+	if err := console.Apu.LoadState(r); err != nil {
+		return err
+	}
+
+	for _, controller := range console.Controllers {
+		if err := controller.LoadState(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Snapshots the whole machine, so LoadState can resume it exactly where it was
+func (console *Console) SaveState(w io.Writer) error {
+	header := stateHeader{Version: STATE_VERSION, RomHash: console.romHash()}
+	copy(header.Magic[:], STATE_MAGIC)
+
+	var state bytes.Buffer
+	if err := binary.Write(&state, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	if err := console.writeComponents(&state); err != nil {
+		return err
+	}
+
+	_, err := state.WriteTo(w)
+	return err
+}
+
+// Restores a state saved by SaveState with the same ROM. The machine is left
+// untouched when the state is rejected
+func (console *Console) LoadState(r io.Reader) error {
+	var header stateHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("invalid save state: %w", err)
+	}
+
+	if string(header.Magic[:]) != STATE_MAGIC {
+		return fmt.Errorf("not a save state: invalid magic % X", header.Magic)
+	}
+	if header.Version != STATE_VERSION {
+		return fmt.Errorf("unsupported save state version %v, expected %v", header.Version, STATE_VERSION)
+	}
+	if header.RomHash != console.romHash() {
+		return fmt.Errorf("save state of a different rom: hash %X", header.RomHash)
+	}
+
+	state, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	// The size depends only on the cartridge, checking it first avoids
+	// loading half a state
+	var current bytes.Buffer
+	if err := console.writeComponents(&current); err != nil {
+		return err
+	}
+	if len(state) != current.Len() {
+		return fmt.Errorf("invalid save state: %v bytes, expected %v", len(state), current.Len())
+	}
+
+	return console.readComponents(bytes.NewReader(state))
+}
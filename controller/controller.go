@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"io"
+	"nes-go/emulator"
+)
+
+// Buttons pressed in a standard controller, in the order they're reported
+type Buttons byte
+
+const (
+	BUTTON_A Buttons = 1 << iota
+	BUTTON_B
+	BUTTON_SELECT
+	BUTTON_START
+	BUTTON_UP
+	BUTTON_DOWN
+	BUTTON_LEFT
+	BUTTON_RIGHT
+)
+
+// Anything plugged into a controller port. Writes to $4016 reach every
+// device, reads of $4016 and $4017 the one of each port
+type InputDevice interface {
+	// Bit 0 is the strobe line
+	Write(value byte)
+	// Only the lowest 5 bits are driven, the rest come from the open bus
+	Read() byte
+}
+
+// Standard controller: while the strobe is high the buttons are latched
+// continuously, when it goes low they're shifted out one by one
+type StandardController struct {
+	buttons Buttons
+	shift   byte
+	strobe  bool
+}
+
+func NewStandardController() *StandardController {
+	return &StandardController{}
+}
+
+// Buttons held from now on, usually set once per frame
+func (controller *StandardController) SetButtons(buttons Buttons) {
+	controller.buttons = buttons
+}
+
+func (controller *StandardController) Buttons() Buttons {
+	return controller.buttons
+}
+
+func (controller *StandardController) Write(value byte) {
+	controller.strobe = value&1 != 0
+	if controller.strobe {
+		controller.shift = byte(controller.buttons)
+	}
+}
+
+// After the 8 buttons an official controller returns 1s
+func (controller *StandardController) Read() byte {
+	if controller.strobe {
+		return byte(controller.buttons & BUTTON_A)
+	}
+
+	bit := controller.shift & 1
+	controller.shift = controller.shift>>1 | 0x80
+
+	return bit
+}
+
+func (controller *StandardController) SaveState(w io.Writer) error {
+	return emulator.WriteState(w, &controller.buttons, &controller.shift, &controller.strobe)
+}
+
+func (controller *StandardController) LoadState(r io.Reader) error {
+	return emulator.ReadState(r, &controller.buttons, &controller.shift, &controller.strobe)
+}
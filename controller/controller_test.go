@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nes-go/emulator"
+	"testing"
+)
+
+func newTestPorts(t *testing.T) (*Ports, *emulator.Memory) {
+	cartridge := make([]byte, emulator.HEADER_SIZE+emulator.PRG_BYTES_UNITS*emulator.BYTES_IN_KILOBYTES)
+	copy(cartridge, emulator.INES_MAGIC)
+	cartridge[4] = 1
+
+	rom, err := emulator.NewRom(cartridge)
+	assert.Nil(t, err)
+	mem, err := emulator.NewMemory(rom)
+	assert.Nil(t, err)
+
+	return NewPorts(mem), mem
+}
+
+func readButtons(mem *emulator.Memory, address uint16, count int) []byte {
+	bits := make([]byte, count)
+	for i := range bits {
+		val, _ := mem.ReadCpu(address)
+		bits[i] = val & 1
+	}
+
+	return bits
+}
+
+func TestStandardController(t *testing.T) {
+	ports, mem := newTestPorts(t)
+	controller := NewStandardController()
+	ports.Connect(0, controller)
+
+	controller.SetButtons(BUTTON_A | BUTTON_START | BUTTON_RIGHT)
+	mem.WriteCpu(1, PORT_1)
+	mem.WriteCpu(0, PORT_1)
+
+	// Official controllers report 1 after the 8 buttons
+	assert.Equal(t, []byte{1, 0, 0, 1, 0, 0, 0, 1, 1, 1}, readButtons(mem, PORT_1, 10))
+
+	// Changes aren't seen until the next strobe
+	controller.SetButtons(BUTTON_B)
+	assert.Equal(t, []byte{1}, readButtons(mem, PORT_1, 1))
+	mem.WriteCpu(1, PORT_1)
+	mem.WriteCpu(0, PORT_1)
+	assert.Equal(t, []byte{0, 1, 0}, readButtons(mem, PORT_1, 3))
+
+	// While the strobe is high reads keep returning A
+	controller.SetButtons(BUTTON_A)
+	mem.WriteCpu(1, PORT_1)
+	assert.Equal(t, []byte{1, 1, 1}, readButtons(mem, PORT_1, 3))
+}
+
+func TestPorts(t *testing.T) {
+	ports, mem := newTestPorts(t)
+	controller := NewStandardController()
+	ports.Connect(1, controller)
+	assert.Equal(t, controller, ports.Device(1))
+
+	controller.SetButtons(BUTTON_A)
+	mem.WriteCpu(0x41, PORT_1)
+	mem.WriteCpu(0x40, PORT_1)
+
+	// The upper bits come from the open bus
+	val, _ := mem.ReadCpu(PORT_2)
+	assert.Equal(t, byte(0x41), val)
+
+	// Empty ports don't drive the lower bits
+	val, _ = mem.ReadCpu(PORT_1)
+	assert.Equal(t, byte(0x40), val)
+}
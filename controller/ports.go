@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"nes-go/emulator"
+)
+
+const (
+	PORT_1 = 0x4016
+	PORT_2 = 0x4017
+
+	PORTS_COUNT = 2
+
+	// Lines of the data bus driven by the devices
+	PORT_DATA_MASK byte = 0x1f
+)
+
+// The two controller ports, mapped to $4016 and $4017. $4017 writes go to the APU
+type Ports struct {
+	mem     *emulator.Memory
+	devices [PORTS_COUNT]InputDevice
+}
+
+func NewPorts(memory *emulator.Memory) *Ports {
+	ports := &Ports{mem: memory}
+
+	// The IO register range is always available, so this can't fail
+	memory.AttachDevice(PORT_1, PORT_1, ports)
+	memory.AttachReadDevice(PORT_2, PORT_2, ports)
+
+	return ports
+}
+
+// Plugs a device into a port, 0 or 1. A nil device leaves the port empty
+func (ports *Ports) Connect(port int, device InputDevice) {
+	ports.devices[port] = device
+}
+
+func (ports *Ports) Device(port int) InputDevice {
+	return ports.devices[port]
+}
+
+func (ports *Ports) Read(address uint16) byte {
+	value := ports.mem.OpenBus() &^ PORT_DATA_MASK
+
+	if device := ports.devices[address-PORT_1]; device != nil {
+		value |= device.Read() & PORT_DATA_MASK
+	}
+
+	return value
+}
+
+func (ports *Ports) Write(value byte, address uint16) {
+	for _, device := range ports.devices {
+		if device != nil {
+			device.Write(value)
+		}
+	}
+}
@@ -51,6 +51,12 @@ function step_disassembler() {
     });
 }
 
+function step_back_disassembler() {
+    $.post("/step-back", (data) => {
+        fill_information();
+    });
+}
+
 function continue_disassembler() {
     let breakpoints = [];
     $(".disassembly-line.selected .address").each(function () {
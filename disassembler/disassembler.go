@@ -1,9 +1,11 @@
 package disassembler
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"math"
+	"nes-go/console"
 	"nes-go/emulator"
 	"nes-go/mos6502"
 	"net/http"
@@ -11,82 +13,87 @@ import (
 
 type Disassembler struct {
 	Instructions map[uint16]*mos6502.Instruction
-	Cpu          *mos6502.CPU
+	Console      *console.Console
 	startPc      uint16
 }
 
-func NewDisassembler(cpu *mos6502.CPU) *Disassembler {
+func NewDisassembler(nes *console.Console) *Disassembler {
+	cpu := nes.Cpu
 	instructions := make(map[uint16]*mos6502.Instruction)
 	startPc := cpu.Pc
 	logger := emulator.GetDisassemblyLogger()
 
-	for pc := cpu.Pc; pc < math.MaxUint16; pc = cpu.Pc {
-		instruction := cpu.GetNextInstruction()
+	for pc := cpu.Pc; pc < math.MaxUint16; {
+		instruction := cpu.Disassemble(pc)
 		instructions[pc] = instruction
 		logger.Printf("[%04X] %v", pc, instruction.InstructionText)
+
+		if instruction.NextPc < pc {
+			break
+		}
+		pc = instruction.NextPc
 	}
 
 	return &Disassembler{
 		Instructions: instructions,
-		Cpu:          cpu,
+		Console:      nes,
 		startPc:      startPc,
 	}
 }
 
 func (disassembler *Disassembler) Run() {
-	disassembler.Cpu.Pc = disassembler.startPc
-
-	for {
-		instruction := disassembler.Instructions[disassembler.Cpu.Pc]
+	disassembler.Console.Cpu.Pc = disassembler.startPc
+	disassembler.Console.Run()
+}
 
-		if instruction == nil {
-			instruction = disassembler.Cpu.GetNextInstruction()
-			//disassembler.instructions[disassembler.cpu.Pc] = instruction
-		}
+func (disassembler *Disassembler) Step() {
+	disassembler.Console.StepInstruction()
+}
 
-		disassembler.Cpu.Pc = instruction.Pc + 1
-		instruction.Run(disassembler.Cpu)
-	}
+// Goes back to the start of the current frame, or to the previous one when
+// it just started
+func (disassembler *Disassembler) StepBack() error {
+	return disassembler.Console.Rewind(1)
 }
 
-func (disassembler *Disassembler) Step() {
-	currentInstruction, got := disassembler.Instructions[disassembler.Cpu.Pc]
+func (disassembler *Disassembler) currentInstruction() *mos6502.Instruction {
+	instruction, got := disassembler.Instructions[disassembler.Console.Cpu.Pc]
 	if !got {
-		currentInstruction = disassembler.Cpu.GetNextInstruction()
+		instruction = disassembler.Console.Cpu.Disassemble(disassembler.Console.Cpu.Pc)
 	}
-	disassembler.Cpu.Pc = currentInstruction.Pc + 1
-	currentInstruction.Run(disassembler.Cpu)
+
+	return instruction
 }
 
 func (disassembler *Disassembler) Disassemble() {
-	disassembler.Cpu.Pc = disassembler.startPc
+	disassembler.Console.Cpu.Pc = disassembler.startPc
 
 	var input string
 	for {
-		currentInstruction := disassembler.Instructions[disassembler.Cpu.Pc]
-		if currentInstruction == nil {
-			currentInstruction = disassembler.Cpu.GetNextInstruction()
-		}
-		disassembler.Cpu.Pc = currentInstruction.Pc + 1
+		currentInstruction := disassembler.currentInstruction()
 
-		fmt.Printf("%v\n", disassembler.Cpu)
+		fmt.Printf("%v\n", disassembler.Console.Cpu)
 		fmt.Printf("\x1b[1;33m%v\x1b[0m\n", currentInstruction)
 
 		next := currentInstruction
 		for range 10 {
 			next = disassembler.Instructions[next.NextPc]
-			if next != nil {
-				fmt.Printf("%v\n", next)
+			if next == nil {
+				break
 			}
+			fmt.Printf("%v\n", next)
 		}
 
 		fmt.Scanln(&input)
-		currentInstruction.Run(disassembler.Cpu)
+		disassembler.Step()
 	}
 }
 
-func (disassembler *Disassembler) DisassembleWeb() {
-	disassembler.Cpu.Pc = disassembler.startPc
+// Serves the web disassembler until stop is closed, then waits for the
+// requests in flight to finish
+func (disassembler *Disassembler) DisassembleWeb(stop <-chan struct{}) error {
+	disassembler.Console.Cpu.Pc = disassembler.startPc
+	disassembler.Console.EnableRewind(console.DEFAULT_REWIND_FRAMES)
 
 	fmt.Println("Starting web server on port http://localhost:8080...")
 
@@ -97,10 +104,21 @@ func (disassembler *Disassembler) DisassembleWeb() {
 
 	http.HandleFunc("/instructions", disassembler.GetInstructions)
 	http.HandleFunc("/step", disassembler.StepHandler)
+	http.HandleFunc("/step-back", disassembler.StepBackHandler)
 	http.HandleFunc("/continue", disassembler.ContinueHandler)
 	http.HandleFunc("/cpu-state", disassembler.GetCpuState)
 	http.HandleFunc("/memory-dump", disassembler.GetMemoryDump)
 
-	err := http.ListenAndServe(":8080", nil)
-	log.Fatal(err)
+	server := &http.Server{Addr: ":8080"}
+	shutdown := make(chan error, 1)
+	go func() {
+		<-stop
+		shutdown <- server.Shutdown(context.Background())
+	}()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return <-shutdown
 }
@@ -10,7 +10,7 @@ func (disassembler *Disassembler) GetInstructions(w http.ResponseWriter, r *http
 
 	instructionsData := InstructionsData{
 		Instructions: disassembler.Instructions,
-		Pc:           disassembler.Cpu.Pc,
+		Pc:           disassembler.Console.Cpu.Pc,
 	}
 	json.NewEncoder(w).Encode(instructionsData)
 }
@@ -26,17 +26,31 @@ func (disassembler *Disassembler) StepHandler(w http.ResponseWriter, r *http.Req
 	w.WriteHeader(http.StatusOK)
 }
 
+func (disassembler *Disassembler) StepBackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := disassembler.StepBack(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 func (disassembler *Disassembler) GetCpuState(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	cpuStateData := disassembler.Cpu.GetStateData()
+	cpuStateData := disassembler.Console.Cpu.GetStateData()
 	json.NewEncoder(w).Encode(cpuStateData)
 }
 
 func (disassembler *Disassembler) GetMemoryDump(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	dump := disassembler.Cpu.Dump()
+	dump := disassembler.Console.Cpu.Dump()
 	json.NewEncoder(w).Encode(dump)
 }
 
@@ -58,9 +72,9 @@ func (disassembler *Disassembler) ContinueHandler(w http.ResponseWriter, r *http
 	disassembler.Step()
 
 outerLoop:
-	for {
+	for !disassembler.Console.Stopped() {
 		for _, bp := range requestData.Breakpoints {
-			if disassembler.Cpu.Pc == bp {
+			if disassembler.Console.Cpu.Pc == bp {
 				break outerLoop
 			}
 		}
@@ -0,0 +1,44 @@
+package emulator
+
+import (
+	"errors"
+	"os"
+)
+
+func batteryRam(mapper Mapper) []byte {
+	battery, ok := mapper.(BatteryBacked)
+	if !ok {
+		return nil
+	}
+
+	return battery.BatteryRam()
+}
+
+// Restores the battery backed RAM. A missing save file isn't an error,
+// the game just starts without saved data
+func LoadBatterySave(mapper Mapper, path string) error {
+	ram := batteryRam(mapper)
+	if ram == nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	copy(ram, data)
+	return nil
+}
+
+func WriteBatterySave(mapper Mapper, path string) error {
+	ram := batteryRam(mapper)
+	if ram == nil {
+		return nil
+	}
+
+	return os.WriteFile(path, ram, 0644)
+}
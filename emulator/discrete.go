@@ -0,0 +1,201 @@
+package emulator
+
+const (
+	LATCH_PRG_BANK_SIZE     = 0x8000
+	LATCH_PRG_BANK_SIZE_16K = 0x4000
+)
+
+// Boards built from discrete logic, with a single latch register written
+// anywhere in $8000-$FFFF. On most of them both the CPU and the PRG ROM
+// drive the data bus during the write, so the latched value is the AND
+// of the written byte and the byte stored in ROM at that address
+type latchMapper struct {
+	prg          []byte
+	chr          []byte
+	chrWritable  bool
+	arrangement  NametableArrangement
+	busConflicts bool
+
+	prgBankSize int
+	fixLastBank bool
+	prgBank     int
+	chrBank     int
+
+	openBus func() byte
+}
+
+func newLatchMapper(rom *Rom, prgBankSize int, busConflicts bool) latchMapper {
+	chr, chrWritable := chrMemory(rom)
+
+	return latchMapper{
+		prg:          rom.PrgData,
+		chr:          chr,
+		chrWritable:  chrWritable,
+		arrangement:  rom.NtArrangement,
+		busConflicts: busConflicts,
+		prgBankSize:  prgBankSize,
+	}
+}
+
+func (latch *latchMapper) SetOpenBus(openBus func() byte) {
+	latch.openBus = openBus
+}
+
+func (latch *latchMapper) prgOffset(address uint16) int {
+	window := int(address-PRG_ROM_START) / latch.prgBankSize
+	bank := latch.prgBank
+
+	if latch.fixLastBank && window > 0 {
+		bank = prgBanksCount(latch.prg, latch.prgBankSize) - 1
+	}
+
+	offset := bank*latch.prgBankSize + int(address-PRG_ROM_START)%latch.prgBankSize
+	return offset % len(latch.prg)
+}
+
+func (latch *latchMapper) chrOffset(address uint16) int {
+	offset := latch.chrBank*CHR_DATA_SIZE + int(address)
+	return offset % len(latch.chr)
+}
+
+// Value seen by the latch, and whether the write reaches it at all
+func (latch *latchMapper) latched(value byte, address uint16) (byte, bool) {
+	if address < PRG_ROM_START {
+		return 0, false
+	}
+
+	if latch.busConflicts {
+		value &= latch.prg[latch.prgOffset(address)]
+	}
+
+	return value, true
+}
+
+func (latch *latchMapper) ReadCpu(address uint16) byte {
+	// No PRG RAM on these boards, nothing drives the bus
+	if address < PRG_ROM_START {
+		if latch.openBus != nil {
+			return latch.openBus()
+		}
+		return 0
+	}
+
+	return latch.prg[latch.prgOffset(address)]
+}
+
+func (latch *latchMapper) ReadPpu(address uint16) byte {
+	return latch.chr[latch.chrOffset(address)]
+}
+
+func (latch *latchMapper) WritePpu(value byte, address uint16) {
+	if latch.chrWritable {
+		latch.chr[latch.chrOffset(address)] = value
+	}
+}
+
+func (latch *latchMapper) Mirroring() NametableArrangement {
+	return latch.arrangement
+}
+
+func (latch *latchMapper) IRQ() bool {
+	return false
+}
+
+// Mapper 2. Switchable 16 KB bank at $8000, last bank fixed at $C000
+type UxROM struct {
+	latchMapper
+}
+
+func NewUxROM(rom *Rom) *UxROM {
+	uxrom := &UxROM{newLatchMapper(rom, LATCH_PRG_BANK_SIZE_16K, hasBusConflicts(rom, true))}
+	uxrom.fixLastBank = true
+
+	return uxrom
+}
+
+func (uxrom *UxROM) WriteCpu(value byte, address uint16) {
+	if value, ok := uxrom.latched(value, address); ok {
+		uxrom.prgBank = int(value)
+	}
+}
+
+// Mapper 3. Fixed PRG ROM, switchable 8 KB CHR bank
+type CNROM struct {
+	latchMapper
+}
+
+func NewCNROM(rom *Rom) *CNROM {
+	return &CNROM{newLatchMapper(rom, LATCH_PRG_BANK_SIZE, hasBusConflicts(rom, true))}
+}
+
+func (cnrom *CNROM) WriteCpu(value byte, address uint16) {
+	if value, ok := cnrom.latched(value, address); ok {
+		cnrom.chrBank = int(value)
+	}
+}
+
+// Mapper 7. Switchable 32 KB bank and single screen mirroring selected
+// by bit 4. AOROM boards avoid bus conflicts, ANROM and AMROM have them
+type AxROM struct {
+	latchMapper
+}
+
+func NewAxROM(rom *Rom) *AxROM {
+	axrom := &AxROM{newLatchMapper(rom, LATCH_PRG_BANK_SIZE, hasBusConflicts(rom, false))}
+	axrom.arrangement = SINGLE_SCREEN_LOWER
+
+	return axrom
+}
+
+func (axrom *AxROM) WriteCpu(value byte, address uint16) {
+	value, ok := axrom.latched(value, address)
+	if !ok {
+		return
+	}
+
+	axrom.prgBank = int(value & 0x07)
+	if value&0x10 != 0 {
+		axrom.arrangement = SINGLE_SCREEN_UPPER
+	} else {
+		axrom.arrangement = SINGLE_SCREEN_LOWER
+	}
+}
+
+// Mapper 11. Switchable 32 KB PRG bank in the low bits and 8 KB CHR bank
+// in the high nibble
+type ColorDreams struct {
+	latchMapper
+}
+
+func NewColorDreams(rom *Rom) *ColorDreams {
+	return &ColorDreams{newLatchMapper(rom, LATCH_PRG_BANK_SIZE, true)}
+}
+
+func (colorDreams *ColorDreams) WriteCpu(value byte, address uint16) {
+	if value, ok := colorDreams.latched(value, address); ok {
+		colorDreams.prgBank = int(value & 0x03)
+		colorDreams.chrBank = int(value >> 4)
+	}
+}
+
+// Mapper 66. Switchable 32 KB PRG bank in bits 4-5 and 8 KB CHR bank in bits 0-1
+type GxROM struct {
+	latchMapper
+}
+
+func NewGxROM(rom *Rom) *GxROM {
+	return &GxROM{newLatchMapper(rom, LATCH_PRG_BANK_SIZE, true)}
+}
+
+func (gxrom *GxROM) WriteCpu(value byte, address uint16) {
+	if value, ok := gxrom.latched(value, address); ok {
+		gxrom.prgBank = int(value>>4) & 0x03
+		gxrom.chrBank = int(value & 0x03)
+	}
+}
+
+func (latch *latchMapper) StateFields() []any {
+	fields := []any{&latch.prgBank, &latch.chrBank, &latch.arrangement}
+
+	return append(fields, chrStateFields(latch.chr, latch.chrWritable)...)
+}
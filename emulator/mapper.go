@@ -0,0 +1,101 @@
+package emulator
+
+import "fmt"
+
+const UNSUPPORTED_MAPPER_MSG = "unsupported mapper: %v"
+
+// Cartridge hardware. The CPU side covers $6000-$FFFF (PRG RAM and ROM)
+// and the PPU side covers $0000-$1FFF (pattern tables)
+type Mapper interface {
+	ReadCpu(address uint16) byte
+	WriteCpu(value byte, address uint16)
+	ReadPpu(address uint16) byte
+	WritePpu(value byte, address uint16)
+
+	// Current nametable arrangement, which some mappers can switch
+	Mirroring() NametableArrangement
+
+	// State of the mapper IRQ line
+	IRQ() bool
+
+	// Registers and RAM saved in save states, see WriteState
+	StateFields() []any
+}
+
+// Mappers that need to know the CPU cycle of their accesses
+type ClockedMapper interface {
+	SetClock(clock func() uint64)
+}
+
+// Mappers with areas that can be disabled, which leave the data bus floating.
+// openBus returns the last value driven on it
+type OpenBusMapper interface {
+	SetOpenBus(openBus func() byte)
+}
+
+// Mappers that watch every PPU access, like the MMC3 which clocks its
+// scanline counter with the A12 line. The cycle is the PPU one
+type PpuAddressWatcher interface {
+	WatchPpuAddress(address uint16, cycle uint64)
+}
+
+// Mappers with battery backed PRG RAM. Returns nil if the cartridge has no battery
+type BatteryBacked interface {
+	BatteryRam() []byte
+}
+
+func NewMapper(rom *Rom) (Mapper, error) {
+	switch rom.MapperId {
+	case 0:
+		return NewNROM(rom), nil
+	case 1:
+		return NewMMC1(rom), nil
+	case 2:
+		return NewUxROM(rom), nil
+	case 3:
+		return NewCNROM(rom), nil
+	case 4:
+		return NewMMC3(rom), nil
+	case 7:
+		return NewAxROM(rom), nil
+	case 11:
+		return NewColorDreams(rom), nil
+	case 66:
+		return NewGxROM(rom), nil
+	}
+
+	return nil, fmt.Errorf(UNSUPPORTED_MAPPER_MSG, rom.MapperId)
+}
+
+// Number of PRG banks of a mapper. NES 2.0 allows PRG ROM smaller than
+// a bank, which is mirrored to fill it
+func prgBanksCount(prg []byte, bankSize int) int {
+	return max(len(prg)/bankSize, 1)
+}
+
+// Cartridges without CHR ROM have CHR RAM instead, 8 KB unless
+// the NES 2.0 header says otherwise
+func chrMemory(rom *Rom) (chr []byte, writable bool) {
+	if len(rom.ChrData) == 0 {
+		size := rom.ChrRamSize + rom.ChrNvramSize
+		if size == 0 {
+			size = CHR_DATA_SIZE
+		}
+		return make([]byte, size), true
+	}
+
+	return rom.ChrData, false
+}
+
+// NES 2.0 submappers of UxROM, CNROM and AxROM tell whether the board
+// has bus conflicts: 1 means no, 2 means yes, 0 keeps the board default
+func hasBusConflicts(rom *Rom, boardDefault bool) bool {
+	switch rom.Submapper {
+	case 1:
+		return false
+	case 2:
+		return true
+	}
+
+	return boardDefault
+}
@@ -0,0 +1,587 @@
+package emulator
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Builds an iNES image where every byte of PRG holds the number of
+// its 8 KB bank and every byte of CHR holds the number of its 1 KB bank
+func newTestCartridge(mapperId byte, prgBanks, chrBanks byte) []byte {
+	header := []byte{'N', 'E', 'S', 0x1a, prgBanks, chrBanks, mapperId << 4, mapperId & 0xf0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	prg := make([]byte, int(prgBanks)*PRG_BYTES_UNITS*BYTES_IN_KILOBYTES)
+	for i := range prg {
+		prg[i] = byte(i / 0x2000)
+	}
+
+	chr := make([]byte, int(chrBanks)*CHR_BYTES_UNITS*BYTES_IN_KILOBYTES)
+	for i := range chr {
+		chr[i] = byte(i / 0x0400)
+	}
+
+	return append(append(header, prg...), chr...)
+}
+
+func newTestRom(t *testing.T, cartridge []byte) *Rom {
+	rom, err := NewRom(cartridge)
+	assert.Nil(t, err)
+
+	return rom
+}
+
+func newTestMapper(t *testing.T, mapperId byte, prgBanks, chrBanks byte) Mapper {
+	rom := newTestRom(t, newTestCartridge(mapperId, prgBanks, chrBanks))
+	mapper, err := NewMapper(rom)
+	assert.Nil(t, err)
+
+	return mapper
+}
+
+func TestUnsupportedMapper(t *testing.T) {
+	rom := newTestRom(t, newTestCartridge(0xfe, 1, 1))
+	_, err := NewMapper(rom)
+	assert.NotNil(t, err)
+}
+
+func TestMapperId(t *testing.T) {
+	rom := newTestRom(t, newTestCartridge(0x42, 1, 1))
+	assert.Equal(t, uint16(0x42), rom.MapperId)
+}
+
+func TestInesHeader(t *testing.T) {
+	cartridge := newTestCartridge(1, 2, 1)
+	cartridge[6] |= 0x0b
+	cartridge[9] = 0x01
+
+	rom := newTestRom(t, cartridge)
+	assert.False(t, rom.IsNes2)
+	assert.Equal(t, uint16(1), rom.MapperId)
+	assert.Equal(t, FOUR_SCREEN, rom.NtArrangement)
+	assert.True(t, rom.HasBattery)
+	assert.Equal(t, 0x8000, rom.PrgRomSize)
+	assert.Equal(t, 0x2000, rom.ChrRomSize)
+	// 0 in byte 8 means 8 KB of PRG RAM
+	assert.Equal(t, 0x2000, rom.PrgRamSize)
+	assert.Equal(t, TIMING_PAL, rom.Timing)
+
+	// Garbage at the end of the header hides the upper mapper nibble
+	cartridge = newTestCartridge(0x42, 1, 1)
+	copy(cartridge[7:HEADER_SIZE], "DiskDude!")
+	assert.Equal(t, uint16(0x02), newTestRom(t, cartridge).MapperId)
+}
+
+func TestNes2Header(t *testing.T) {
+	cartridge := newTestCartridge(0x42, 1, 1)
+	cartridge[7] |= 0x08
+	cartridge[8] = 0x31
+	cartridge[10] = 0x77
+	cartridge[11] = 0x07
+	cartridge[12] = 0x03
+	cartridge[13] = 0x12
+	cartridge[15] = 0x01
+
+	rom := newTestRom(t, cartridge)
+	assert.True(t, rom.IsNes2)
+	assert.Equal(t, uint16(0x142), rom.MapperId)
+	assert.Equal(t, byte(3), rom.Submapper)
+	assert.Equal(t, 0x4000, rom.PrgRomSize)
+	assert.Equal(t, 0x2000, rom.ChrRomSize)
+	assert.Equal(t, 0x2000, rom.PrgRamSize)
+	assert.Equal(t, 0x2000, rom.PrgNvramSize)
+	assert.Equal(t, 0x2000, rom.ChrRamSize)
+	assert.Equal(t, 0, rom.ChrNvramSize)
+	assert.Equal(t, TIMING_DENDY, rom.Timing)
+	assert.Equal(t, byte(0x12), rom.ConsoleTypeData)
+	assert.Equal(t, byte(0x01), rom.ExpansionDevice)
+
+	// Exponent-multiplier notation: 2^14 * 1 bytes of PRG ROM
+	cartridge[4] = 14 << 2
+	cartridge[9] = 0x0f
+	assert.Equal(t, 0x4000, newTestRom(t, cartridge).PrgRomSize)
+}
+
+func TestInvalidRoms(t *testing.T) {
+	_, err := NewRom([]byte{'N', 'E', 'S'})
+	assert.NotNil(t, err)
+
+	cartridge := newTestCartridge(0, 1, 1)
+	cartridge[0] = 'X'
+	_, err = NewRom(cartridge)
+	assert.NotNil(t, err)
+
+	cartridge = newTestCartridge(0, 1, 1)
+	_, err = NewRom(cartridge[:len(cartridge)-1])
+	assert.NotNil(t, err)
+
+	// The trainer pushes the CHR ROM past the end of the file
+	cartridge[6] |= 0x04
+	_, err = NewRom(cartridge)
+	assert.NotNil(t, err)
+
+	_, err = NewRom(newTestCartridge(0, 0, 1))
+	assert.NotNil(t, err)
+
+	// NES 2.0 exponent-multiplier sizes that overflow an int
+	cartridge = make([]byte, 64)
+	copy(cartridge, INES_MAGIC)
+	cartridge[4] = 0xfc
+	cartridge[7] = 0x08
+	cartridge[9] = 0x0f
+	_, err = NewRom(cartridge)
+	assert.ErrorContains(t, err, "too big")
+
+	// Or that are just bigger than the file
+	cartridge[4] = 40 << 2
+	_, err = NewRom(cartridge)
+	assert.ErrorContains(t, err, "truncated")
+}
+
+func TestSmallPrg(t *testing.T) {
+	// NES 2.0 allows PRG ROM smaller than the banks of the mapper,
+	// which is mirrored to fill them
+	for _, mapperId := range []byte{1, 2, 4} {
+		for _, exponent := range []byte{12, 13} {
+			prg := make([]byte, 1<<exponent)
+			for i := range prg {
+				prg[i] = byte(i >> 8)
+			}
+
+			cartridge := newTestCartridge(mapperId, 0, 1)
+			cartridge[4] = exponent << 2
+			cartridge[7] |= 0x08
+			cartridge[9] = 0x0f
+			cartridge = append(append(cartridge[:HEADER_SIZE:HEADER_SIZE], prg...), cartridge[HEADER_SIZE:]...)
+
+			mapper, err := NewMapper(newTestRom(t, cartridge))
+			assert.Nil(t, err)
+
+			for _, address := range []uint16{0x8000, 0x9fff, 0xa100, 0xbfff, 0xc200, 0xdfff, 0xe300, 0xffff} {
+				assert.Equal(t, prg[int(address)%len(prg)], mapper.ReadCpu(address), "mapper %v, %v bytes, $%04X", mapperId, len(prg), address)
+			}
+		}
+	}
+}
+
+func TestNROM128(t *testing.T) {
+	nrom := newTestMapper(t, 0, 1, 1)
+
+	// 16 KB of PRG ROM are mirrored
+	assert.Equal(t, byte(0), nrom.ReadCpu(0x8000))
+	assert.Equal(t, byte(1), nrom.ReadCpu(0xbfff))
+	assert.Equal(t, byte(0), nrom.ReadCpu(0xc000))
+	assert.Equal(t, byte(1), nrom.ReadCpu(0xffff))
+
+	assert.Equal(t, byte(7), nrom.ReadPpu(0x1fff))
+}
+
+func TestNROM256(t *testing.T) {
+	nrom := newTestMapper(t, 0, 2, 1)
+
+	assert.Equal(t, byte(0), nrom.ReadCpu(0x8000))
+	assert.Equal(t, byte(2), nrom.ReadCpu(0xc000))
+	assert.Equal(t, byte(3), nrom.ReadCpu(0xffff))
+
+	// PRG ROM is read only
+	nrom.WriteCpu(0xaa, 0x8000)
+	assert.Equal(t, byte(0), nrom.ReadCpu(0x8000))
+
+	nrom.WriteCpu(0xaa, 0x6000)
+	assert.Equal(t, byte(0xaa), nrom.ReadCpu(0x6000))
+}
+
+func TestChrRam(t *testing.T) {
+	nrom := newTestMapper(t, 0, 1, 0)
+
+	nrom.WritePpu(0x55, 0x0123)
+	assert.Equal(t, byte(0x55), nrom.ReadPpu(0x0123))
+
+	nrom = newTestMapper(t, 0, 1, 1)
+	nrom.WritePpu(0x55, 0x0123)
+	assert.Equal(t, byte(0), nrom.ReadPpu(0x0123))
+}
+
+func TestSmallChr(t *testing.T) {
+	// NES 2.0 header with 2 KB of CHR RAM
+	cartridge := newTestCartridge(0, 1, 0)
+	cartridge[7] |= 0x08
+	cartridge[11] = 0x05
+	nrom, err := NewMapper(newTestRom(t, cartridge))
+	assert.Nil(t, err)
+
+	nrom.WritePpu(0x55, 0x1fff)
+	assert.Equal(t, byte(0x55), nrom.ReadPpu(0x07ff))
+
+	// 1 KB of CHR ROM in exponent-multiplier notation
+	cartridge = append(newTestCartridge(0, 1, 0), make([]byte, 0x400)...)
+	cartridge[7] |= 0x08
+	cartridge[5] = 10 << 2
+	cartridge[9] = 0xf0
+	cartridge[len(cartridge)-1] = 0x66
+	nrom, err = NewMapper(newTestRom(t, cartridge))
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0x66), nrom.ReadPpu(0x1fff))
+}
+
+type testClock struct {
+	cycle uint64
+}
+
+func (clock *testClock) now() uint64 {
+	return clock.cycle
+}
+
+func newTestMMC1(t *testing.T, prgBanks, chrBanks byte) (*MMC1, *testClock) {
+	mmc1 := newTestMapper(t, 1, prgBanks, chrBanks).(*MMC1)
+	clock := &testClock{}
+	mmc1.SetClock(clock.now)
+
+	return mmc1, clock
+}
+
+// Writes the five lowest bits of value through the serial port
+func mmc1Write(mmc1 *MMC1, clock *testClock, value byte, address uint16) {
+	for i := range MMC1_SHIFT_WRITES {
+		clock.cycle += 4
+		mmc1.WriteCpu((value>>i)&1, address)
+	}
+}
+
+func TestMMC1PrgModes(t *testing.T) {
+	mmc1, clock := newTestMMC1(t, 8, 2)
+
+	// Power on: last bank fixed at $C000
+	assert.Equal(t, byte(0), mmc1.ReadCpu(0x8000))
+	assert.Equal(t, byte(14), mmc1.ReadCpu(0xc000))
+
+	mmc1Write(mmc1, clock, 3, 0xe000)
+	assert.Equal(t, byte(6), mmc1.ReadCpu(0x8000))
+	assert.Equal(t, byte(14), mmc1.ReadCpu(0xc000))
+
+	// First bank fixed at $8000
+	mmc1Write(mmc1, clock, 0x08, 0x8000)
+	assert.Equal(t, byte(0), mmc1.ReadCpu(0x8000))
+	assert.Equal(t, byte(6), mmc1.ReadCpu(0xc000))
+
+	// 32 KB mode ignores the lowest bit
+	mmc1Write(mmc1, clock, 0x00, 0x8000)
+	assert.Equal(t, byte(4), mmc1.ReadCpu(0x8000))
+	assert.Equal(t, byte(6), mmc1.ReadCpu(0xc000))
+}
+
+func TestMMC1ChrModes(t *testing.T) {
+	mmc1, clock := newTestMMC1(t, 2, 4)
+
+	// 8 KB mode ignores the lowest bit
+	mmc1Write(mmc1, clock, 3, 0xa000)
+	assert.Equal(t, byte(8), mmc1.ReadPpu(0x0000))
+	assert.Equal(t, byte(12), mmc1.ReadPpu(0x1000))
+
+	mmc1Write(mmc1, clock, 0x10, 0x8000)
+	mmc1Write(mmc1, clock, 5, 0xc000)
+	assert.Equal(t, byte(12), mmc1.ReadPpu(0x0000))
+	assert.Equal(t, byte(20), mmc1.ReadPpu(0x1000))
+}
+
+func TestMMC1Mirroring(t *testing.T) {
+	mmc1, clock := newTestMMC1(t, 2, 2)
+
+	expected := []NametableArrangement{SINGLE_SCREEN_LOWER, SINGLE_SCREEN_UPPER, HORIZONTAL, VERTICAL}
+	for mode, arrangement := range expected {
+		mmc1Write(mmc1, clock, byte(mode)|MMC1_CONTROL_RESET, 0x8000)
+		assert.Equal(t, arrangement, mmc1.Mirroring())
+	}
+}
+
+func TestMMC1ResetAndConsecutiveWrites(t *testing.T) {
+	mmc1, clock := newTestMMC1(t, 8, 2)
+
+	mmc1Write(mmc1, clock, 0x08, 0x8000)
+	assert.Equal(t, byte(0), mmc1.ReadCpu(0x8000))
+
+	// Writing a value with bit 7 set resets the shift register and the PRG mode
+	clock.cycle += 4
+	mmc1.WriteCpu(1, 0xe000)
+	clock.cycle += 4
+	mmc1.WriteCpu(0x80, 0xe000)
+	mmc1Write(mmc1, clock, 2, 0xe000)
+	assert.Equal(t, byte(4), mmc1.ReadCpu(0x8000))
+	assert.Equal(t, byte(14), mmc1.ReadCpu(0xc000))
+
+	// The second write of a read-modify-write instruction is ignored
+	for i := range MMC1_SHIFT_WRITES {
+		clock.cycle += 6
+		mmc1.WriteCpu(0, 0xe000)
+		if i == 0 {
+			mmc1.WriteCpu(1, 0xe000)
+		}
+	}
+	assert.Equal(t, byte(0), mmc1.ReadCpu(0x8000))
+}
+
+func TestMMC1PrgRam(t *testing.T) {
+	mmc1, clock := newTestMMC1(t, 2, 2)
+
+	mmc1.WriteCpu(0x42, 0x6000)
+	assert.Equal(t, byte(0x42), mmc1.ReadCpu(0x6000))
+
+	// Disabled RAM leaves the bus floating
+	mmc1Write(mmc1, clock, MMC1_PRG_RAM_OFF, 0xe000)
+	mmc1.WriteCpu(0x24, 0x6000)
+	mmc1.SetOpenBus(func() byte { return 0x5a })
+	assert.Equal(t, byte(0x5a), mmc1.ReadCpu(0x6000))
+
+	mmc1Write(mmc1, clock, 0, 0xe000)
+	assert.Equal(t, byte(0x42), mmc1.ReadCpu(0x6000))
+}
+
+func TestBatterySave(t *testing.T) {
+	cartridge := newTestCartridge(1, 2, 2)
+	cartridge[6] |= 0x02
+	mapper, _ := NewMapper(newTestRom(t, cartridge))
+	path := filepath.Join(t.TempDir(), "game.sav")
+
+	// No save file yet
+	assert.Nil(t, LoadBatterySave(mapper, path))
+
+	mapper.WriteCpu(0x99, 0x7fff)
+	assert.Nil(t, WriteBatterySave(mapper, path))
+
+	mapper, _ = NewMapper(newTestRom(t, cartridge))
+	assert.Nil(t, LoadBatterySave(mapper, path))
+	assert.Equal(t, byte(0x99), mapper.ReadCpu(0x7fff))
+}
+
+func TestMMC3PrgBanks(t *testing.T) {
+	mmc3 := newTestMapper(t, 4, 8, 8).(*MMC3)
+
+	mmc3.WriteCpu(6, 0x8000)
+	mmc3.WriteCpu(3, 0x8001)
+	mmc3.WriteCpu(7, 0x8000)
+	mmc3.WriteCpu(5, 0x8001)
+
+	assert.Equal(t, byte(3), mmc3.ReadCpu(0x8000))
+	assert.Equal(t, byte(5), mmc3.ReadCpu(0xa000))
+	assert.Equal(t, byte(14), mmc3.ReadCpu(0xc000))
+	assert.Equal(t, byte(15), mmc3.ReadCpu(0xe000))
+
+	// PRG mode 1 swaps $8000 and $C000
+	mmc3.WriteCpu(0x40, 0x8000)
+	assert.Equal(t, byte(14), mmc3.ReadCpu(0x8000))
+	assert.Equal(t, byte(3), mmc3.ReadCpu(0xc000))
+}
+
+func TestMMC3ChrBanks(t *testing.T) {
+	mmc3 := newTestMapper(t, 4, 2, 8).(*MMC3)
+
+	for register, bank := range []byte{9, 20, 30, 31, 40, 41} {
+		mmc3.WriteCpu(byte(register), 0x8000)
+		mmc3.WriteCpu(bank, 0x8001)
+	}
+
+	expected := []byte{8, 9, 20, 21, 30, 31, 40, 41}
+	for slot, bank := range expected {
+		assert.Equal(t, bank, mmc3.ReadPpu(uint16(slot)*MMC3_CHR_BANK_SIZE))
+	}
+
+	// A12 inversion
+	mmc3.WriteCpu(0x80, 0x8000)
+	for slot, bank := range expected {
+		assert.Equal(t, bank, mmc3.ReadPpu(uint16(slot)*MMC3_CHR_BANK_SIZE^PPU_A12))
+	}
+}
+
+func TestMMC3MirroringAndPrgRam(t *testing.T) {
+	mmc3 := newTestMapper(t, 4, 2, 2).(*MMC3)
+
+	mmc3.WriteCpu(0, 0xa000)
+	assert.Equal(t, HORIZONTAL, mmc3.Mirroring())
+	mmc3.WriteCpu(1, 0xa000)
+	assert.Equal(t, VERTICAL, mmc3.Mirroring())
+
+	mmc3.WriteCpu(0x12, 0x6000)
+	assert.Equal(t, byte(0x12), mmc3.ReadCpu(0x6000))
+
+	// Write protected
+	mmc3.WriteCpu(MMC3_PRG_RAM_ENABLE|MMC3_PRG_RAM_WP, 0xa001)
+	mmc3.WriteCpu(0x34, 0x6000)
+	assert.Equal(t, byte(0x12), mmc3.ReadCpu(0x6000))
+
+	// Disabled, the value comes from the open bus
+	mem, err := NewMemory(newTestRom(t, newTestCartridge(4, 2, 2)))
+	assert.Nil(t, err)
+	mem.WriteCpu(0, 0xa001)
+	mem.WriteCpu(0x5a, 0x0000)
+	mem.ReadCpu(0x0000)
+	value, _ := mem.ReadCpu(0x6000)
+	assert.Equal(t, byte(0x5a), value)
+}
+
+// Simulates the PPU fetching background tiles from $0000 and sprites from $1000
+func mmc3Scanline(mmc3 *MMC3, cycle *uint64) {
+	for range 32 {
+		*cycle += 8
+		mmc3.WatchPpuAddress(0x2000, *cycle)
+		mmc3.WatchPpuAddress(0x0000, *cycle)
+	}
+	for range 8 {
+		*cycle += 8
+		mmc3.WatchPpuAddress(0x1000, *cycle)
+	}
+	*cycle += 21
+}
+
+func TestMMC3Irq(t *testing.T) {
+	mmc3 := newTestMapper(t, 4, 2, 2).(*MMC3)
+	var cycle uint64
+
+	mmc3.WriteCpu(2, 0xc000)
+	mmc3.WriteCpu(0, 0xc001)
+	mmc3.WriteCpu(0, 0xe001)
+
+	// The counter goes 2, 1, 0
+	for range 2 {
+		mmc3Scanline(mmc3, &cycle)
+		assert.False(t, mmc3.IRQ())
+	}
+	mmc3Scanline(mmc3, &cycle)
+	assert.True(t, mmc3.IRQ())
+
+	// Acknowledge
+	mmc3.WriteCpu(0, 0xe000)
+	assert.False(t, mmc3.IRQ())
+
+	// Edges closer than the filter are ignored
+	mmc3.WriteCpu(0, 0xc001)
+	mmc3.WatchPpuAddress(0x0000, cycle+1)
+	mmc3.WatchPpuAddress(0x1000, cycle+2)
+	mmc3.WatchPpuAddress(0x0000, cycle+3)
+	mmc3.WatchPpuAddress(0x1000, cycle+4)
+	assert.True(t, mmc3.irqReload)
+}
+
+func TestMMC3A12FromPpuBus(t *testing.T) {
+	mem, err := NewMemory(newTestRom(t, newTestCartridge(4, 2, 2)))
+	assert.Nil(t, err)
+	mmc3 := mem.Mapper.(*MMC3)
+
+	mem.WriteCpu(5, 0xc000)
+	mem.PpuCycle = 0
+	mem.ReadPpu(0x0000)
+	mem.PpuCycle = 20
+	mem.ReadPpu(0x1000)
+	assert.Equal(t, byte(5), mmc3.irqCounter)
+}
+
+func TestUxROM(t *testing.T) {
+	uxrom := newTestMapper(t, 2, 8, 0)
+
+	// The ROM byte at $C000 is 14, so bus conflicts turn 3 into 2
+	uxrom.WriteCpu(3, 0xc000)
+	assert.Equal(t, byte(4), uxrom.ReadCpu(0x8000))
+	assert.Equal(t, byte(14), uxrom.ReadCpu(0xc000))
+	assert.Equal(t, byte(15), uxrom.ReadCpu(0xffff))
+
+	// CHR RAM
+	uxrom.WritePpu(0x11, 0x0010)
+	assert.Equal(t, byte(0x11), uxrom.ReadPpu(0x0010))
+}
+
+func TestLatchMapperOpenBus(t *testing.T) {
+	for _, mapperId := range []byte{2, 3, 7, 11, 66} {
+		mem, err := NewMemory(newTestRom(t, newTestCartridge(mapperId, 8, 4)))
+		assert.Nil(t, err)
+
+		// Writes to $6000-$7FFF go nowhere and reads return the last value on the bus
+		mem.WriteCpu(0x42, 0x6000)
+		mem.WriteCpu(0x5a, 0x0000)
+		mem.ReadCpu(0x0000)
+
+		val, _ := mem.ReadCpu(0x6000)
+		assert.Equal(t, byte(0x5a), val, "mapper %v", mapperId)
+		val, _ = mem.ReadCpu(0x7fff)
+		assert.Equal(t, byte(0x5a), val, "mapper %v", mapperId)
+	}
+}
+
+func TestCNROM(t *testing.T) {
+	cnrom := newTestMapper(t, 3, 1, 4)
+
+	// The ROM byte at $BFFF is 1, so bus conflicts turn 3 into 1
+	cnrom.WriteCpu(3, 0xbfff)
+	assert.Equal(t, byte(8), cnrom.ReadPpu(0x0000))
+	assert.Equal(t, byte(0), cnrom.ReadCpu(0xc000))
+}
+
+func TestAxROM(t *testing.T) {
+	axrom := newTestMapper(t, 7, 8, 0)
+	assert.Equal(t, SINGLE_SCREEN_LOWER, axrom.Mirroring())
+
+	// No bus conflicts, even if the ROM byte at $8000 is 0
+	axrom.WriteCpu(0x13, 0x8000)
+	assert.Equal(t, byte(12), axrom.ReadCpu(0x8000))
+	assert.Equal(t, byte(15), axrom.ReadCpu(0xffff))
+	assert.Equal(t, SINGLE_SCREEN_UPPER, axrom.Mirroring())
+}
+
+func TestColorDreams(t *testing.T) {
+	colorDreams := newTestMapper(t, 11, 8, 4)
+
+	// The ROM byte at $FFFF is 3, so the PRG bank bits are kept
+	colorDreams.WriteCpu(0x31, 0xffff)
+	assert.Equal(t, byte(4), colorDreams.ReadCpu(0x8000))
+	assert.Equal(t, byte(0), colorDreams.ReadPpu(0x0000))
+}
+
+func TestGxROM(t *testing.T) {
+	gxrom := newTestMapper(t, 66, 8, 4).(*GxROM)
+
+	// The ROM byte at $E000 is 3, so bus conflicts clear the PRG bank bits
+	gxrom.WriteCpu(0x33, 0xe000)
+	assert.Equal(t, byte(0), gxrom.ReadCpu(0x8000))
+	assert.Equal(t, byte(24), gxrom.ReadPpu(0x0000))
+
+	gxrom.busConflicts = false
+	gxrom.WriteCpu(0x21, 0x8000)
+	assert.Equal(t, byte(8), gxrom.ReadCpu(0x8000))
+	assert.Equal(t, byte(8), gxrom.ReadPpu(0x0000))
+}
+
+func TestMapperState(t *testing.T) {
+	axrom := newTestMapper(t, 7, 8, 0)
+	axrom.WriteCpu(0x13, 0x8000)
+	axrom.WritePpu(0x11, 0x0010)
+
+	var state bytes.Buffer
+	assert.Nil(t, WriteState(&state, axrom.StateFields()...))
+
+	restored := newTestMapper(t, 7, 8, 0)
+	assert.Nil(t, ReadState(&state, restored.StateFields()...))
+	assert.Equal(t, byte(12), restored.ReadCpu(0x8000))
+	assert.Equal(t, byte(0x11), restored.ReadPpu(0x0010))
+	assert.Equal(t, SINGLE_SCREEN_UPPER, restored.Mirroring())
+	assert.Zero(t, state.Len())
+
+	// Half written MMC1 shift register, with its last write cycle
+	mmc1, clock := newTestMMC1(t, 8, 0)
+	for _, bit := range []byte{1, 1} {
+		clock.cycle += 4
+		mmc1.WriteCpu(bit, 0xe000)
+	}
+	assert.Nil(t, WriteState(&state, mmc1.StateFields()...))
+
+	restoredMmc1, restoredClock := newTestMMC1(t, 8, 0)
+	restoredClock.cycle = clock.cycle
+	assert.Nil(t, ReadState(&state, restoredMmc1.StateFields()...))
+
+	restoredClock.cycle++
+	restoredMmc1.WriteCpu(1, 0xe000)
+	for _, bit := range []byte{0, 0, 0} {
+		restoredClock.cycle += 4
+		restoredMmc1.WriteCpu(bit, 0xe000)
+	}
+	assert.Equal(t, byte(3), restoredMmc1.prgBank)
+}
@@ -2,16 +2,43 @@ package emulator
 
 import (
 	"fmt"
+	"io"
 )
 
 const (
-	WRITE_ERROR_MSG = "write index out of range: %04X"
-	READ_ERROR_MSG  = "read index out of range: %04X"
+	WRITE_ERROR_MSG  = "write index out of range: %04X"
+	READ_ERROR_MSG   = "read index out of range: %04X"
+	DEVICE_ERROR_MSG = "no memory mapped registers in range: %04X-%04X"
 )
 
+/*
+* CPU memory map:
+*	$0000-$07FF 	$0800 	2 KB internal RAM
+*	$0800-$1FFF 	$1800 	Mirrors of $0000-$07FF
+*	$2000-$2007 	$0008 	PPU registers
+*	$2008-$3FFF 	$1FF8 	Mirrors of $2000-$2007 (repeats every 8 bytes)
+*	$4000-$4017 	$0018 	APU and I/O registers
+*	$4018-$401F 	$0008 	APU and I/O functionality that is normally disabled
+*	$4020-$5FFF 	$1FE0 	Unmapped, available for cartridge use
+*	$6000-$7FFF 	$2000 	Cartridge PRG RAM
+*	$8000-$FFFF 	$8000 	Cartridge PRG ROM
+ */
 const (
-	CPU_MEMORY_SIZE = 0x8000 // $6000-7FFF: PRG RAM
-	PPU_MEMORY_SIZE = 0x2000
+	CPU_RAM_SIZE = 0x0800
+	PRG_RAM_SIZE = 0x2000
+
+	RAM_MIRRORS_END = 0x2000
+
+	PPU_REGISTERS_START = 0x2000
+	PPU_REGISTERS_END   = 0x4000
+	PPU_REGISTERS_COUNT = 8
+
+	IO_REGISTERS_START = 0x4000
+	IO_REGISTERS_END   = 0x4020
+	IO_REGISTERS_COUNT = IO_REGISTERS_END - IO_REGISTERS_START
+
+	PRG_RAM_START = 0x6000
+	PRG_ROM_START = 0x8000
 
 	ZERO_PAGE_START  = 0x0000
 	ZERO_PAGE_FINISH = 0x0100
@@ -20,74 +47,270 @@ const (
 	STACK_FINISH = 0x0200
 )
 
+/*
+* PPU memory map:
+*	$0000-$1FFF 	$2000 	Pattern tables, handled by the mapper
+*	$2000-$2FFF 	$1000 	Nametables, mapped to the CIRAM by the mirroring
+*	$3000-$3EFF 	$0F00 	Mirrors of $2000-$2EFF
+*	$3F00-$3F1F 	$0020 	Palette RAM indexes
+*	$3F20-$3FFF 	$00E0 	Mirrors of $3F00-$3F1F
+ */
+const (
+	PPU_ADDRESS_END = 0x4000
+
+	NAMETABLES_START = 0x2000
+	NAMETABLE_SIZE   = 0x0400
+	// The console has 2 KB of CIRAM, four screen boards add another 2 KB
+	VRAM_SIZE = 0x1000
+
+	PALETTE_START = 0x3f00
+	PALETTE_SIZE  = 0x20
+)
+
+// Handler of memory mapped registers, like the PPU, APU or controller ones.
+// The address received is the one of the register, with the mirrors resolved
+type Device interface {
+	Read(address uint16) byte
+	Write(value byte, address uint16)
+}
+
+type deviceSlot struct {
+	reader Device
+	writer Device
+}
+
 type Memory struct {
-	CPUData [CPU_MEMORY_SIZE]byte
-	PPUData [PPU_MEMORY_SIZE]byte
+	CPUData [CPU_RAM_SIZE]byte
+	Vram    [VRAM_SIZE]byte
+	Palette [PALETTE_SIZE]byte
 	RomData *Rom
+	Mapper  Mapper
+
+	// CPU cycle of the current access, kept up to date by the CPU
+	CpuCycle uint64
+	// PPU cycle of the current access, kept up to date by the PPU
+	PpuCycle uint64
+	// CPU cycles stolen by DMA transfers, consumed by the CPU
+	StallCycles uint64
+
+	ppuWatcher PpuAddressWatcher
+
+	ppuRegisters [PPU_REGISTERS_COUNT]deviceSlot
+	ioRegisters  [IO_REGISTERS_COUNT]deviceSlot
+
+	// Last value driven on the data bus, returned by reads of unmapped addresses
+	openBus byte
 }
 
-func NewMemory(cartridge *Rom) *Memory {
-	return &Memory{RomData: cartridge}
+func NewMemory(cartridge *Rom) (*Memory, error) {
+	mapper, err := NewMapper(cartridge)
+	if err != nil {
+		return nil, err
+	}
+
+	mem := &Memory{RomData: cartridge, Mapper: mapper}
+
+	if clocked, ok := mapper.(ClockedMapper); ok {
+		clocked.SetClock(func() uint64 { return mem.CpuCycle })
+	}
+
+	if floating, ok := mapper.(OpenBusMapper); ok {
+		floating.SetOpenBus(mem.OpenBus)
+	}
+
+	if watcher, ok := mapper.(PpuAddressWatcher); ok {
+		mem.ppuWatcher = watcher
+	}
+
+	return mem, nil
 }
 
-func (mem *Memory) ReadPpu(address uint16) (byte, error) {
-	if address < CHR_DATA_SIZE {
-		return mem.RomData.ChrData[address], nil
+func (mem *Memory) deviceSlot(address uint16) *deviceSlot {
+	switch {
+	case address >= PPU_REGISTERS_START && address < PPU_REGISTERS_END:
+		return &mem.ppuRegisters[(address-PPU_REGISTERS_START)%PPU_REGISTERS_COUNT]
+	case address >= IO_REGISTERS_START && address < IO_REGISTERS_END:
+		return &mem.ioRegisters[address-IO_REGISTERS_START]
+	}
+
+	return nil
+}
+
+func (mem *Memory) attach(start, end uint16, reader, writer Device) error {
+	for address := uint32(start); address <= uint32(end); address++ {
+		slot := mem.deviceSlot(uint16(address))
+		if slot == nil {
+			return fmt.Errorf(DEVICE_ERROR_MSG, start, end)
+		}
+
+		if reader != nil {
+			slot.reader = reader
+		}
+		if writer != nil {
+			slot.writer = writer
+		}
 	}
 
-	address -= CHR_DATA_SIZE
-	if int(address) > PPU_MEMORY_SIZE {
+	return nil
+}
+
+// Maps the registers from start to end (both included) to the device
+func (mem *Memory) AttachDevice(start, end uint16, device Device) error {
+	return mem.attach(start, end, device, device)
+}
+
+func (mem *Memory) AttachReadDevice(start, end uint16, device Device) error {
+	return mem.attach(start, end, device, nil)
+}
+
+func (mem *Memory) AttachWriteDevice(start, end uint16, device Device) error {
+	return mem.attach(start, end, nil, device)
+}
+
+func (mem *Memory) OpenBus() byte {
+	return mem.openBus
+}
+
+func (mem *Memory) ReadPpu(address uint16) (byte, error) {
+	if address >= PPU_ADDRESS_END {
 		return 0, fmt.Errorf(READ_ERROR_MSG, address)
 	}
 
-	// TODO: What to do with mirrors of $3f00-$3f1f?
-	return mem.PPUData[address], nil
+	if mem.ppuWatcher != nil {
+		mem.ppuWatcher.WatchPpuAddress(address, mem.PpuCycle)
+	}
+
+	switch {
+	case address < CHR_DATA_SIZE:
+		return mem.Mapper.ReadPpu(address), nil
+	case address < PALETTE_START:
+		return mem.Vram[mem.vramIndex(address)], nil
+	}
+
+	return mem.Palette[paletteIndex(address)], nil
 }
 
 func (mem *Memory) WritePpu(value byte, address uint16) error {
-	if address < CHR_DATA_SIZE {
-		mem.RomData.ChrData[address] = value
-		return nil
+	if address >= PPU_ADDRESS_END {
+		return fmt.Errorf(WRITE_ERROR_MSG, address)
 	}
 
-	address -= CHR_DATA_SIZE
-	if int(address) > PPU_MEMORY_SIZE {
-		return fmt.Errorf(WRITE_ERROR_MSG, address)
+	if mem.ppuWatcher != nil {
+		mem.ppuWatcher.WatchPpuAddress(address, mem.PpuCycle)
+	}
+
+	switch {
+	case address < CHR_DATA_SIZE:
+		mem.Mapper.WritePpu(value, address)
+	case address < PALETTE_START:
+		mem.Vram[mem.vramIndex(address)] = value
+	default:
+		mem.Palette[paletteIndex(address)] = value
 	}
 
-	// TODO: What to do with mirrors of $3f00-$3f1f?
-	mem.PPUData[address] = value
 	return nil
 }
 
+// Maps a nametable address to the VRAM following the mirroring of the cartridge
+func (mem *Memory) vramIndex(address uint16) uint16 {
+	// $3000-$3EFF mirror the nametables
+	address = (address - NAMETABLES_START) % VRAM_SIZE
+	offset := address % NAMETABLE_SIZE
+	nametable := address / NAMETABLE_SIZE
+
+	switch mem.Mapper.Mirroring() {
+	case HORIZONTAL:
+		// Vertical mirroring: $2000 = $2800 and $2400 = $2C00
+		nametable &= 1
+	case VERTICAL:
+		// Horizontal mirroring: $2000 = $2400 and $2800 = $2C00
+		nametable >>= 1
+	case SINGLE_SCREEN_LOWER:
+		nametable = 0
+	case SINGLE_SCREEN_UPPER:
+		nametable = 1
+	}
+
+	return nametable*NAMETABLE_SIZE + offset
+}
+
+// The backdrop entries of the sprite palettes, $3F10/$3F14/$3F18/$3F1C,
+// are mirrors of the background ones
+func paletteIndex(address uint16) uint16 {
+	index := (address - PALETTE_START) % PALETTE_SIZE
+	if index >= 0x10 && index%4 == 0 {
+		index -= 0x10
+	}
+
+	return index
+}
+
+// Palette RAM entry looked up while drawing pixels, from 0 to $1F. It's internal
+// to the PPU, so unlike ReadPpu the address never reaches the cartridge
+func (mem *Memory) ReadPalette(index byte) byte {
+	return mem.Palette[paletteIndex(PALETTE_START+uint16(index))]
+}
+
 func (mem *Memory) ReadCpu(address uint16) (byte, error) {
-	if address < CPU_MEMORY_SIZE {
-		return mem.CPUData[address], nil
+	val, err := mem.readCpu(address)
+	if err == nil {
+		mem.openBus = val
 	}
 
-	address -= CPU_MEMORY_SIZE
-	if int(address) > len(mem.RomData.PrgData) {
-		return 0, fmt.Errorf(READ_ERROR_MSG, address)
+	return val, err
+}
+
+func (mem *Memory) readCpu(address uint16) (byte, error) {
+	switch {
+	case address < RAM_MIRRORS_END:
+		return mem.CPUData[address%CPU_RAM_SIZE], nil
+
+	case address < IO_REGISTERS_END:
+		slot := mem.deviceSlot(address)
+		if slot.reader == nil {
+			return mem.openBus, nil
+		}
+		return slot.reader.Read(registerAddress(address)), nil
+
+	case address < PRG_RAM_START:
+		return mem.openBus, nil
 	}
 
-	return mem.RomData.PrgData[address], nil
+	return mem.Mapper.ReadCpu(address), nil
 }
 
 func (mem *Memory) WriteCpu(value byte, address uint16) error {
-	if address < CPU_MEMORY_SIZE {
-		mem.CPUData[address] = value
+	mem.openBus = value
+
+	switch {
+	case address < RAM_MIRRORS_END:
+		mem.CPUData[address%CPU_RAM_SIZE] = value
 		return nil
-	}
 
-	address -= CPU_MEMORY_SIZE
-	if int(address) > len(mem.RomData.PrgData) {
-		return fmt.Errorf(WRITE_ERROR_MSG, address)
+	case address < IO_REGISTERS_END:
+		slot := mem.deviceSlot(address)
+		if slot.writer != nil {
+			slot.writer.Write(value, registerAddress(address))
+		}
+		return nil
+
+	case address < PRG_RAM_START:
+		return nil
 	}
 
-	mem.RomData.PrgData[address] = value
+	mem.Mapper.WriteCpu(value, address)
 	return nil
 }
 
+// Resolves the mirrors of the PPU registers
+func registerAddress(address uint16) uint16 {
+	if address < PPU_REGISTERS_END {
+		return PPU_REGISTERS_START + (address-PPU_REGISTERS_START)%PPU_REGISTERS_COUNT
+	}
+
+	return address
+}
+
 func (mem Memory) getDump(start, finish, step int) map[int]string {
 	dump := make(map[int]string, 0)
 
@@ -110,3 +333,21 @@ func (mem Memory) ZeroPageDump() map[int]string {
 func (mem Memory) StackDump() map[int]string {
 	return mem.getDump(STACK_START, STACK_FINISH, 32)
 }
+
+// RAM, registers of the bus and the state of the mapper
+func (mem *Memory) stateFields() []any {
+	fields := []any{
+		mem.CPUData[:], mem.Vram[:], mem.Palette[:],
+		&mem.CpuCycle, &mem.PpuCycle, &mem.StallCycles, &mem.openBus,
+	}
+
+	return append(fields, mem.Mapper.StateFields()...)
+}
+
+func (mem *Memory) SaveState(w io.Writer) error {
+	return WriteState(w, mem.stateFields()...)
+}
+
+func (mem *Memory) LoadState(r io.Reader) error {
+	return ReadState(r, mem.stateFields()...)
+}
@@ -0,0 +1,165 @@
+package emulator
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getEmptyRom() *Rom {
+	rom_data := slices.Repeat([]byte{0}, 16400)
+	copy(rom_data, INES_MAGIC)
+	rom_data[4] = 1
+
+	rom, _ := NewRom(rom_data)
+	return rom
+}
+
+type registersDevice struct {
+	registers map[uint16]byte
+}
+
+func (device *registersDevice) Read(address uint16) byte {
+	return device.registers[address]
+}
+
+func (device *registersDevice) Write(value byte, address uint16) {
+	device.registers[address] = value
+}
+
+func newRegistersDevice() *registersDevice {
+	return &registersDevice{registers: make(map[uint16]byte)}
+}
+
+func TestRamMirrors(t *testing.T) {
+	mem, _ := NewMemory(getEmptyRom())
+
+	err := mem.WriteCpu(0xaa, 0x0012)
+	assert.Nil(t, err)
+
+	for _, addr := range []uint16{0x0012, 0x0812, 0x1012, 0x1812} {
+		val, err := mem.ReadCpu(addr)
+		assert.Nil(t, err)
+		assert.Equal(t, byte(0xaa), val)
+	}
+
+	mem.WriteCpu(0xbb, 0x1fff)
+	assert.Equal(t, byte(0xbb), mem.CPUData[0x07ff])
+}
+
+func TestPpuRegisterMirrors(t *testing.T) {
+	mem, _ := NewMemory(getEmptyRom())
+	device := newRegistersDevice()
+
+	err := mem.AttachDevice(0x2000, 0x2007, device)
+	assert.Nil(t, err)
+
+	mem.WriteCpu(0x12, 0x3456)
+	assert.Equal(t, byte(0x12), device.registers[0x2006])
+
+	device.registers[0x2002] = 0x80
+	val, _ := mem.ReadCpu(0x200a)
+	assert.Equal(t, byte(0x80), val)
+}
+
+func TestIoRegisters(t *testing.T) {
+	mem, _ := NewMemory(getEmptyRom())
+	controller := newRegistersDevice()
+	apu := newRegistersDevice()
+
+	assert.Nil(t, mem.AttachDevice(0x4016, 0x4017, controller))
+	assert.Nil(t, mem.AttachWriteDevice(0x4017, 0x4017, apu))
+	assert.NotNil(t, mem.AttachDevice(0x4100, 0x4101, apu))
+
+	mem.WriteCpu(0x40, 0x4017)
+	assert.Equal(t, byte(0x40), apu.registers[0x4017])
+	assert.NotContains(t, controller.registers, uint16(0x4017))
+
+	controller.registers[0x4017] = 0x41
+	val, _ := mem.ReadCpu(0x4017)
+	assert.Equal(t, byte(0x41), val)
+}
+
+func TestOpenBus(t *testing.T) {
+	mem, _ := NewMemory(getEmptyRom())
+
+	mem.WriteCpu(0x5a, 0x0000)
+	mem.ReadCpu(0x0000)
+
+	val, err := mem.ReadCpu(0x5000)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0x5a), val)
+
+	val, _ = mem.ReadCpu(0x4018)
+	assert.Equal(t, byte(0x5a), val)
+}
+
+func TestPrgRam(t *testing.T) {
+	mem, _ := NewMemory(getEmptyRom())
+
+	mem.WriteCpu(0x77, 0x6010)
+	val, _ := mem.ReadCpu(0x6010)
+	assert.Equal(t, byte(0x77), val)
+}
+
+func TestNametableMirroring(t *testing.T) {
+	// Addresses that land in the same VRAM for each arrangement
+	mirrors := map[NametableArrangement][][2]uint16{
+		HORIZONTAL:          {{0x2000, 0x2800}, {0x2400, 0x2c00}},
+		VERTICAL:            {{0x2000, 0x2400}, {0x2800, 0x2c00}},
+		SINGLE_SCREEN_LOWER: {{0x2000, 0x2c00}, {0x2400, 0x2800}},
+		FOUR_SCREEN:         {{0x2000, 0x3000}, {0x2c00, 0x3c00}},
+	}
+
+	for arrangement, pairs := range mirrors {
+		rom := getEmptyRom()
+		rom.NtArrangement = arrangement
+		mem, _ := NewMemory(rom)
+
+		for i, pair := range pairs {
+			mem.WritePpu(byte(i+1), pair[0]+0x15)
+			val, _ := mem.ReadPpu(pair[1] + 0x15)
+			assert.Equal(t, byte(i+1), val, "arrangement %v: $%04X", arrangement, pair[1])
+		}
+	}
+
+	rom := getEmptyRom()
+	rom.NtArrangement = FOUR_SCREEN
+	mem, _ := NewMemory(rom)
+	for i := range uint16(4) {
+		mem.WritePpu(byte(i), NAMETABLES_START+i*NAMETABLE_SIZE)
+	}
+	for i := range uint16(4) {
+		val, _ := mem.ReadPpu(NAMETABLES_START + i*NAMETABLE_SIZE)
+		assert.Equal(t, byte(i), val)
+	}
+}
+
+func TestPaletteMirrors(t *testing.T) {
+	mem, _ := NewMemory(getEmptyRom())
+
+	mem.WritePpu(0x21, 0x3f10)
+	val, _ := mem.ReadPpu(0x3f00)
+	assert.Equal(t, byte(0x21), val)
+
+	mem.WritePpu(0x0f, 0x3f1c)
+	val, _ = mem.ReadPpu(0x3f0c)
+	assert.Equal(t, byte(0x0f), val)
+
+	// Only the backdrop entries are shared
+	mem.WritePpu(0x30, 0x3f11)
+	val, _ = mem.ReadPpu(0x3f01)
+	assert.Equal(t, byte(0x00), val)
+
+	val, _ = mem.ReadPpu(0x3f31)
+	assert.Equal(t, byte(0x30), val)
+}
+
+func TestPpuOutOfRange(t *testing.T) {
+	mem, _ := NewMemory(getEmptyRom())
+
+	_, err := mem.ReadPpu(PPU_ADDRESS_END)
+	assert.NotNil(t, err)
+	assert.NotNil(t, mem.WritePpu(0, PPU_ADDRESS_END))
+}
@@ -0,0 +1,229 @@
+package emulator
+
+const (
+	MMC1_SHIFT_RESET    = 0x80
+	MMC1_SHIFT_WRITES   = 5
+	MMC1_CONTROL_RESET  = 0x0c
+	MMC1_PRG_RAM_OFF    = 0x10
+	MMC1_PRG_BANK_SIZE  = 0x4000
+	MMC1_CHR_BANK_SIZE  = 0x1000
+	MMC1_OUTER_PRG_SIZE = 0x40000
+)
+
+// Mapper 1. Registers are written one bit at a time through a serial
+// shift register, the fifth write selects the register by address:
+//
+//	$8000-$9FFF	Control: mirroring, PRG and CHR modes
+//	$A000-$BFFF	CHR bank 0
+//	$C000-$DFFF	CHR bank 1
+//	$E000-$FFFF	PRG bank and PRG RAM enable
+type MMC1 struct {
+	prg         []byte
+	chr         []byte
+	chrWritable bool
+	prgRam      [PRG_RAM_SIZE]byte
+	battery     bool
+
+	shift      byte
+	shiftCount byte
+	control    byte
+	chrBank0   byte
+	chrBank1   byte
+	prgBank    byte
+
+	clock     func() uint64
+	lastWrite uint64
+	written   bool
+
+	openBus func() byte
+}
+
+func NewMMC1(rom *Rom) *MMC1 {
+	chr, chrWritable := chrMemory(rom)
+
+	return &MMC1{
+		prg:         rom.PrgData,
+		chr:         chr,
+		chrWritable: chrWritable,
+		battery:     rom.HasBattery,
+		control:     MMC1_CONTROL_RESET,
+	}
+}
+
+func (mmc1 *MMC1) SetClock(clock func() uint64) {
+	mmc1.clock = clock
+}
+
+func (mmc1 *MMC1) SetOpenBus(openBus func() byte) {
+	mmc1.openBus = openBus
+}
+
+func (mmc1 *MMC1) prgRamEnabled() bool {
+	return mmc1.prgBank&MMC1_PRG_RAM_OFF == 0
+}
+
+// 512 KB boards (SUROM) use bit 4 of the CHR bank registers to select
+// which 256 KB half of PRG ROM is used
+func (mmc1 *MMC1) prgOffset(address uint16) int {
+	var bank int
+	lastBank := prgBanksCount(mmc1.prg, MMC1_PRG_BANK_SIZE) - 1
+	selected := int(mmc1.prgBank & 0x0f)
+
+	var outer int
+	if len(mmc1.prg) > MMC1_OUTER_PRG_SIZE {
+		outer = int(mmc1.chrBank0&0x10) >> 4 * MMC1_OUTER_PRG_SIZE / MMC1_PRG_BANK_SIZE
+		lastBank = MMC1_OUTER_PRG_SIZE/MMC1_PRG_BANK_SIZE - 1
+	}
+
+	upper := address >= 0xc000
+
+	switch (mmc1.control >> 2) & 0x03 {
+	case 0, 1:
+		// 32 KB mode, the lowest bit of the bank number is ignored
+		bank = selected &^ 1
+		if upper {
+			bank |= 1
+		}
+	case 2:
+		// First bank fixed at $8000
+		bank = selected
+		if !upper {
+			bank = 0
+		}
+	case 3:
+		// Last bank fixed at $C000
+		bank = selected
+		if upper {
+			bank = lastBank
+		}
+	}
+
+	offset := (outer+bank)*MMC1_PRG_BANK_SIZE + int(address)%MMC1_PRG_BANK_SIZE
+	return offset % len(mmc1.prg)
+}
+
+func (mmc1 *MMC1) chrOffset(address uint16) int {
+	var bank int
+
+	if mmc1.control&0x10 == 0 {
+		// 8 KB mode, the lowest bit of the bank number is ignored
+		bank = int(mmc1.chrBank0&^1) + int(address/MMC1_CHR_BANK_SIZE)
+	} else if address < MMC1_CHR_BANK_SIZE {
+		bank = int(mmc1.chrBank0)
+	} else {
+		bank = int(mmc1.chrBank1)
+	}
+
+	offset := bank*MMC1_CHR_BANK_SIZE + int(address)%MMC1_CHR_BANK_SIZE
+	return offset % len(mmc1.chr)
+}
+
+func (mmc1 *MMC1) ReadCpu(address uint16) byte {
+	if address < PRG_ROM_START {
+		if mmc1.prgRamEnabled() {
+			return mmc1.prgRam[address-PRG_RAM_START]
+		}
+		if mmc1.openBus != nil {
+			return mmc1.openBus()
+		}
+		return 0
+	}
+
+	return mmc1.prg[mmc1.prgOffset(address)]
+}
+
+func (mmc1 *MMC1) WriteCpu(value byte, address uint16) {
+	if address < PRG_ROM_START {
+		if mmc1.prgRamEnabled() {
+			mmc1.prgRam[address-PRG_RAM_START] = value
+		}
+		return
+	}
+
+	// The serial port ignores writes on consecutive cycles, like the
+	// second write of read-modify-write instructions
+	if mmc1.clock != nil {
+		cycle := mmc1.clock()
+		consecutive := mmc1.written && cycle-mmc1.lastWrite <= 1
+		mmc1.lastWrite = cycle
+		mmc1.written = true
+
+		if consecutive {
+			return
+		}
+	}
+
+	if value&MMC1_SHIFT_RESET != 0 {
+		mmc1.shift = 0
+		mmc1.shiftCount = 0
+		mmc1.control |= MMC1_CONTROL_RESET
+		return
+	}
+
+	mmc1.shift |= (value & 1) << mmc1.shiftCount
+	mmc1.shiftCount++
+
+	if mmc1.shiftCount < MMC1_SHIFT_WRITES {
+		return
+	}
+
+	switch (address >> 13) & 0x03 {
+	case 0:
+		mmc1.control = mmc1.shift
+	case 1:
+		mmc1.chrBank0 = mmc1.shift
+	case 2:
+		mmc1.chrBank1 = mmc1.shift
+	case 3:
+		mmc1.prgBank = mmc1.shift
+	}
+
+	mmc1.shift = 0
+	mmc1.shiftCount = 0
+}
+
+func (mmc1 *MMC1) ReadPpu(address uint16) byte {
+	return mmc1.chr[mmc1.chrOffset(address)]
+}
+
+func (mmc1 *MMC1) WritePpu(value byte, address uint16) {
+	if mmc1.chrWritable {
+		mmc1.chr[mmc1.chrOffset(address)] = value
+	}
+}
+
+func (mmc1 *MMC1) Mirroring() NametableArrangement {
+	switch mmc1.control & 0x03 {
+	case 0:
+		return SINGLE_SCREEN_LOWER
+	case 1:
+		return SINGLE_SCREEN_UPPER
+	case 2:
+		// Vertical mirroring
+		return HORIZONTAL
+	}
+
+	// Horizontal mirroring
+	return VERTICAL
+}
+
+func (mmc1 *MMC1) IRQ() bool {
+	return false
+}
+
+func (mmc1 *MMC1) BatteryRam() []byte {
+	if !mmc1.battery {
+		return nil
+	}
+
+	return mmc1.prgRam[:]
+}
+
+func (mmc1 *MMC1) StateFields() []any {
+	fields := []any{
+		mmc1.prgRam[:], &mmc1.shift, &mmc1.shiftCount, &mmc1.control,
+		&mmc1.chrBank0, &mmc1.chrBank1, &mmc1.prgBank, &mmc1.lastWrite, &mmc1.written,
+	}
+
+	return append(fields, chrStateFields(mmc1.chr, mmc1.chrWritable)...)
+}
@@ -0,0 +1,230 @@
+package emulator
+
+const (
+	MMC3_PRG_BANK_SIZE  = 0x2000
+	MMC3_CHR_BANK_SIZE  = 0x0400
+	MMC3_PRG_RAM_ENABLE = 0x80
+	MMC3_PRG_RAM_WP     = 0x40
+	PPU_A12             = 0x1000
+
+	// PPU cycles A12 has to stay low before a rising edge clocks the
+	// IRQ counter. Filters out the edges between background tile fetches
+	MMC3_A12_FILTER = 10
+)
+
+// Mapper 4. Registers are selected by address range and parity:
+//
+//	$8000 even	Bank select		$8001 odd	Bank data
+//	$A000 even	Mirroring		$A001 odd	PRG RAM protect
+//	$C000 even	IRQ latch		$C001 odd	IRQ reload
+//	$E000 even	IRQ disable		$E001 odd	IRQ enable
+type MMC3 struct {
+	prg         []byte
+	chr         []byte
+	chrWritable bool
+	prgRam      [PRG_RAM_SIZE]byte
+	battery     bool
+
+	bankSelect  byte
+	banks       [8]byte
+	arrangement NametableArrangement
+	prgRamCtrl  byte
+
+	irqLatch   byte
+	irqCounter byte
+	irqReload  bool
+	irqEnabled bool
+	irqPending bool
+
+	a12        bool
+	a12LowFrom uint64
+
+	openBus func() byte
+}
+
+func NewMMC3(rom *Rom) *MMC3 {
+	chr, chrWritable := chrMemory(rom)
+
+	return &MMC3{
+		prg:         rom.PrgData,
+		chr:         chr,
+		chrWritable: chrWritable,
+		battery:     rom.HasBattery,
+		arrangement: rom.NtArrangement,
+		banks:       [8]byte{0, 2, 4, 5, 6, 7, 0, 1},
+		prgRamCtrl:  MMC3_PRG_RAM_ENABLE,
+	}
+}
+
+func (mmc3 *MMC3) SetOpenBus(openBus func() byte) {
+	mmc3.openBus = openBus
+}
+
+func (mmc3 *MMC3) prgOffset(address uint16) int {
+	banksCount := prgBanksCount(mmc3.prg, MMC3_PRG_BANK_SIZE)
+	secondLast := banksCount - 2
+	swapped := mmc3.bankSelect&0x40 != 0
+
+	var bank int
+	switch (address - PRG_ROM_START) / MMC3_PRG_BANK_SIZE {
+	case 0:
+		if swapped {
+			bank = secondLast
+		} else {
+			bank = int(mmc3.banks[6])
+		}
+	case 1:
+		bank = int(mmc3.banks[7])
+	case 2:
+		if swapped {
+			bank = int(mmc3.banks[6])
+		} else {
+			bank = secondLast
+		}
+	case 3:
+		bank = banksCount - 1
+	}
+
+	offset := (bank%banksCount)*MMC3_PRG_BANK_SIZE + int(address)%MMC3_PRG_BANK_SIZE
+	return offset % len(mmc3.prg)
+}
+
+func (mmc3 *MMC3) chrOffset(address uint16) int {
+	// A12 inversion swaps the 2 KB and the 1 KB banks
+	if mmc3.bankSelect&0x80 != 0 {
+		address ^= PPU_A12
+	}
+
+	slot := address / MMC3_CHR_BANK_SIZE
+
+	var bank int
+	if slot < 4 {
+		// R0 and R1 select 2 KB banks, ignoring the lowest bit
+		bank = int(mmc3.banks[slot/2]&^1) + int(slot%2)
+	} else {
+		bank = int(mmc3.banks[slot-2])
+	}
+
+	offset := bank*MMC3_CHR_BANK_SIZE + int(address)%MMC3_CHR_BANK_SIZE
+	return offset % len(mmc3.chr)
+}
+
+func (mmc3 *MMC3) ReadCpu(address uint16) byte {
+	if address < PRG_ROM_START {
+		if mmc3.prgRamCtrl&MMC3_PRG_RAM_ENABLE != 0 {
+			return mmc3.prgRam[address-PRG_RAM_START]
+		}
+		if mmc3.openBus != nil {
+			return mmc3.openBus()
+		}
+		return 0
+	}
+
+	return mmc3.prg[mmc3.prgOffset(address)]
+}
+
+func (mmc3 *MMC3) WriteCpu(value byte, address uint16) {
+	if address < PRG_ROM_START {
+		if mmc3.prgRamCtrl&MMC3_PRG_RAM_ENABLE != 0 && mmc3.prgRamCtrl&MMC3_PRG_RAM_WP == 0 {
+			mmc3.prgRam[address-PRG_RAM_START] = value
+		}
+		return
+	}
+
+	even := address%2 == 0
+
+	switch {
+	case address < 0xa000 && even:
+		mmc3.bankSelect = value
+	case address < 0xa000:
+		mmc3.banks[mmc3.bankSelect&0x07] = value
+	case address < 0xc000 && even:
+		// Boards with four screen VRAM ignore the mirroring register
+		if mmc3.arrangement == FOUR_SCREEN {
+			return
+		}
+
+		if value&1 == 0 {
+			// Vertical mirroring
+			mmc3.arrangement = HORIZONTAL
+		} else {
+			// Horizontal mirroring
+			mmc3.arrangement = VERTICAL
+		}
+	case address < 0xc000:
+		mmc3.prgRamCtrl = value
+	case address < 0xe000 && even:
+		mmc3.irqLatch = value
+	case address < 0xe000:
+		mmc3.irqCounter = 0
+		mmc3.irqReload = true
+	case even:
+		mmc3.irqEnabled = false
+		mmc3.irqPending = false
+	default:
+		mmc3.irqEnabled = true
+	}
+}
+
+func (mmc3 *MMC3) ReadPpu(address uint16) byte {
+	return mmc3.chr[mmc3.chrOffset(address)]
+}
+
+func (mmc3 *MMC3) WritePpu(value byte, address uint16) {
+	if mmc3.chrWritable {
+		mmc3.chr[mmc3.chrOffset(address)] = value
+	}
+}
+
+// Clocks the scanline counter on the rising edges of the PPU A12 line
+func (mmc3 *MMC3) WatchPpuAddress(address uint16, cycle uint64) {
+	a12 := address&PPU_A12 != 0
+
+	if a12 && !mmc3.a12 && cycle-mmc3.a12LowFrom >= MMC3_A12_FILTER {
+		mmc3.clockIrqCounter()
+	}
+	if !a12 && mmc3.a12 {
+		mmc3.a12LowFrom = cycle
+	}
+
+	mmc3.a12 = a12
+}
+
+func (mmc3 *MMC3) clockIrqCounter() {
+	if mmc3.irqCounter == 0 || mmc3.irqReload {
+		mmc3.irqCounter = mmc3.irqLatch
+		mmc3.irqReload = false
+	} else {
+		mmc3.irqCounter--
+	}
+
+	if mmc3.irqCounter == 0 && mmc3.irqEnabled {
+		mmc3.irqPending = true
+	}
+}
+
+func (mmc3 *MMC3) Mirroring() NametableArrangement {
+	return mmc3.arrangement
+}
+
+func (mmc3 *MMC3) IRQ() bool {
+	return mmc3.irqPending
+}
+
+func (mmc3 *MMC3) BatteryRam() []byte {
+	if !mmc3.battery {
+		return nil
+	}
+
+	return mmc3.prgRam[:]
+}
+
+func (mmc3 *MMC3) StateFields() []any {
+	fields := []any{
+		mmc3.prgRam[:], &mmc3.bankSelect, mmc3.banks[:], &mmc3.arrangement, &mmc3.prgRamCtrl,
+		&mmc3.irqLatch, &mmc3.irqCounter, &mmc3.irqReload, &mmc3.irqEnabled, &mmc3.irqPending,
+		&mmc3.a12, &mmc3.a12LowFrom,
+	}
+
+	return append(fields, chrStateFields(mmc3.chr, mmc3.chrWritable)...)
+}
@@ -0,0 +1,59 @@
+package emulator
+
+// Mapper 0. NROM-128 has 16 KB of PRG ROM mirrored in $8000-$BFFF and
+// $C000-$FFFF, NROM-256 has 32 KB filling the whole range
+type NROM struct {
+	prg         []byte
+	chr         []byte
+	chrWritable bool
+	prgRam      [PRG_RAM_SIZE]byte
+	arrangement NametableArrangement
+}
+
+func NewNROM(rom *Rom) *NROM {
+	chr, chrWritable := chrMemory(rom)
+
+	return &NROM{
+		prg:         rom.PrgData,
+		chr:         chr,
+		chrWritable: chrWritable,
+		arrangement: rom.NtArrangement,
+	}
+}
+
+func (nrom *NROM) ReadCpu(address uint16) byte {
+	if address < PRG_ROM_START {
+		return nrom.prgRam[address-PRG_RAM_START]
+	}
+
+	return nrom.prg[int(address-PRG_ROM_START)%len(nrom.prg)]
+}
+
+func (nrom *NROM) WriteCpu(value byte, address uint16) {
+	if address < PRG_ROM_START {
+		nrom.prgRam[address-PRG_RAM_START] = value
+	}
+}
+
+// NES 2.0 boards can have less than 8 KB of CHR, which is mirrored
+func (nrom *NROM) ReadPpu(address uint16) byte {
+	return nrom.chr[int(address)%len(nrom.chr)]
+}
+
+func (nrom *NROM) WritePpu(value byte, address uint16) {
+	if nrom.chrWritable {
+		nrom.chr[int(address)%len(nrom.chr)] = value
+	}
+}
+
+func (nrom *NROM) Mirroring() NametableArrangement {
+	return nrom.arrangement
+}
+
+func (nrom *NROM) IRQ() bool {
+	return false
+}
+
+func (nrom *NROM) StateFields() []any {
+	return append([]any{nrom.prgRam[:]}, chrStateFields(nrom.chr, nrom.chrWritable)...)
+}
@@ -1,6 +1,10 @@
 package emulator
 
-import "log"
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
 
 const (
 	HEADER_SIZE        = 16
@@ -9,72 +13,202 @@ const (
 	BYTES_IN_KILOBYTES = 1024
 	TRAINER_SIZE       = 512
 	CHR_DATA_SIZE      = 0x2000
+	INES_PRG_RAM_UNITS = 8
+
+	// NES 2.0 RAM sizes are stored as shift counts of 64 bytes
+	NES2_RAM_SIZE_BASE = 64
+	// NES 2.0 ROM sizes use the exponent-multiplier notation when
+	// the most significant nibble is $F
+	NES2_EXPONENT_NIBBLE = 0x0f
 )
 
+var INES_MAGIC = []byte{'N', 'E', 'S', 0x1a}
+
 type NametableArrangement byte
 
 const (
 	VERTICAL NametableArrangement = iota
 	HORIZONTAL
+	SINGLE_SCREEN_LOWER
+	SINGLE_SCREEN_UPPER
+	FOUR_SCREEN
+)
+
+type TimingRegion byte
+
+const (
+	TIMING_NTSC TimingRegion = iota
+	TIMING_PAL
+	TIMING_MULTIPLE_REGION
+	TIMING_DENDY
+)
+
+type ConsoleType byte
+
+const (
+	CONSOLE_NES ConsoleType = iota
+	CONSOLE_VS_SYSTEM
+	CONSOLE_PLAYCHOICE_10
+	CONSOLE_EXTENDED
 )
 
 type Rom struct {
-	PrgRomSize uint16
-	ChrRomSize uint16
+	PrgRomSize int
+	ChrRomSize int
 	PrgData    []byte
 	ChrData    []byte
 	Trainer    []byte
 
+	IsNes2        bool
+	MapperId      uint16
+	Submapper     byte
 	NtArrangement NametableArrangement
-	HasPrgRam     bool
+	HasBattery    bool
+
+	// Zero when not specified by the header
+	PrgRamSize   int
+	PrgNvramSize int
+	ChrRamSize   int
+	ChrNvramSize int
+
+	Timing      TimingRegion
+	ConsoleType ConsoleType
+	// VS System PPU and hardware type, or the extended console type
+	ConsoleTypeData byte
+	MiscRoms        byte
+	// Default expansion device, see https://www.nesdev.org/wiki/NES_2.0#Default_Expansion_Device
+	ExpansionDevice byte
 }
 
 func getBit(val byte, idx int) bool {
 	return ((val >> idx) & 1) != 0
 }
 
-func NewRom(cartridge []byte) *Rom {
+// Size of a ROM area from its NES 2.0 least and most significant parts
+func nes2RomSize(name string, lsb, msb byte, units int) (int, error) {
+	if msb == NES2_EXPONENT_NIBBLE {
+		exponent := lsb >> 2
+		multiplier := int(lsb&0x03)*2 + 1
+		// Exponents go up to 63, far more than an int holds
+		if multiplier > math.MaxInt>>exponent {
+			return 0, fmt.Errorf("invalid rom: %v size 2^%v * %v is too big", name, exponent, multiplier)
+		}
+		return (1 << exponent) * multiplier, nil
+	}
+
+	return (int(msb)<<8 | int(lsb)) * units * BYTES_IN_KILOBYTES, nil
+}
+
+func nes2RamSize(shift byte) int {
+	if shift == 0 {
+		return 0
+	}
+
+	return NES2_RAM_SIZE_BASE << shift
+}
+
+func readSection(cartridge []byte, name string, start, size int) ([]byte, error) {
+	if size > len(cartridge)-start {
+		return nil, fmt.Errorf("truncated rom: %v needs %v bytes at offset %v, but the file is %v bytes long", name, size, start, len(cartridge))
+	}
+
+	return cartridge[start : start+size], nil
+}
+
+func NewRom(cartridge []byte) (*Rom, error) {
+	if len(cartridge) < HEADER_SIZE {
+		return nil, fmt.Errorf("rom too short: %v bytes, the header alone is %v", len(cartridge), HEADER_SIZE)
+	}
+
 	header := cartridge[:HEADER_SIZE]
-	var prgSize = int(header[4]) * PRG_BYTES_UNITS * BYTES_IN_KILOBYTES
-	var chrSize = int(header[5]) * CHR_BYTES_UNITS * BYTES_IN_KILOBYTES
+	if !bytes.Equal(header[:len(INES_MAGIC)], INES_MAGIC) {
+		return nil, fmt.Errorf("not an iNES rom: invalid magic % X", header[:len(INES_MAGIC)])
+	}
 
-	var ntArrangement NametableArrangement
+	rom := &Rom{}
 	flags6 := header[6]
-	if getBit(flags6, 0) {
-		ntArrangement = HORIZONTAL
+	flags7 := header[7]
+
+	rom.IsNes2 = flags7&0x0c == 0x08
+	rom.HasBattery = getBit(flags6, 1)
+	rom.ConsoleType = ConsoleType(flags7 & 0x03)
+
+	switch {
+	case getBit(flags6, 3):
+		rom.NtArrangement = FOUR_SCREEN
+	case getBit(flags6, 0):
+		rom.NtArrangement = HORIZONTAL
+	default:
+		rom.NtArrangement = VERTICAL
+	}
+
+	if rom.IsNes2 {
+		rom.MapperId = uint16(flags6>>4) | uint16(flags7&0xf0) | uint16(header[8]&0x0f)<<8
+		rom.Submapper = header[8] >> 4
+
+		var err error
+		rom.PrgRomSize, err = nes2RomSize("PRG ROM", header[4], header[9]&0x0f, PRG_BYTES_UNITS)
+		if err != nil {
+			return nil, err
+		}
+		rom.ChrRomSize, err = nes2RomSize("CHR ROM", header[5], header[9]>>4, CHR_BYTES_UNITS)
+		if err != nil {
+			return nil, err
+		}
+
+		rom.PrgRamSize = nes2RamSize(header[10] & 0x0f)
+		rom.PrgNvramSize = nes2RamSize(header[10] >> 4)
+		rom.ChrRamSize = nes2RamSize(header[11] & 0x0f)
+		rom.ChrNvramSize = nes2RamSize(header[11] >> 4)
+
+		rom.Timing = TimingRegion(header[12] & 0x03)
+		rom.ConsoleTypeData = header[13]
+		rom.MiscRoms = header[14] & 0x03
+		rom.ExpansionDevice = header[15] & 0x3f
 	} else {
-		ntArrangement = VERTICAL
+		rom.MapperId = uint16(flags6 >> 4)
+
+		// Old dumping tools wrote garbage like "DiskDude!" in bytes 7-15,
+		// in which case the upper nibble of the mapper can't be trusted
+		if bytes.Equal(header[12:], make([]byte, HEADER_SIZE-12)) {
+			rom.MapperId |= uint16(flags7 & 0xf0)
+		}
+
+		rom.PrgRomSize = int(header[4]) * PRG_BYTES_UNITS * BYTES_IN_KILOBYTES
+		rom.ChrRomSize = int(header[5]) * CHR_BYTES_UNITS * BYTES_IN_KILOBYTES
+
+		// A value of 0 means 8 KB, for compatibility
+		prgRamUnits := max(int(header[8]), 1)
+		rom.PrgRamSize = prgRamUnits * INES_PRG_RAM_UNITS * BYTES_IN_KILOBYTES
+
+		if getBit(header[9], 0) {
+			rom.Timing = TIMING_PAL
+		}
+	}
+
+	if rom.PrgRomSize == 0 {
+		return nil, fmt.Errorf("invalid rom: no PRG ROM")
 	}
 
 	startPrg := HEADER_SIZE
-	var trainer []byte
+	var err error
 	if getBit(flags6, 2) {
+		rom.Trainer, err = readSection(cartridge, "trainer", HEADER_SIZE, TRAINER_SIZE)
+		if err != nil {
+			return nil, err
+		}
 		startPrg += TRAINER_SIZE
-		trainer = cartridge[HEADER_SIZE : HEADER_SIZE+TRAINER_SIZE]
 	}
 
-	startChr := startPrg + prgSize
-
-	prgData := cartridge[startPrg:startChr]
-
-	// TODO: why?
-	if len(prgData) >= 0x4000 {
-		prgData = append(prgData, prgData...)
+	rom.PrgData, err = readSection(cartridge, "PRG ROM", startPrg, rom.PrgRomSize)
+	if err != nil {
+		return nil, err
 	}
 
-	chrData := cartridge[startChr : startChr+chrSize]
-
-	if len(chrData) != CHR_DATA_SIZE {
-		log.Printf("[Warning] Chr data should be 0x2000 bytes long (len: %v)\n", len(chrData))
+	rom.ChrData, err = readSection(cartridge, "CHR ROM", startPrg+rom.PrgRomSize, rom.ChrRomSize)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Rom{
-		PrgRomSize:    uint16(prgSize),
-		ChrRomSize:    uint16(chrSize),
-		PrgData:       prgData,
-		ChrData:       chrData,
-		Trainer:       trainer,
-		NtArrangement: ntArrangement,
-		HasPrgRam:     getBit(flags6, 1),
-	}
+	return rom, nil
 }
@@ -0,0 +1,52 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Writes the fields of a component for a save state, in order. Fields are
+// pointers to fixed size values, ints included, or byte slices whose length
+// doesn't change while running
+func WriteState(w io.Writer, fields ...any) error {
+	for _, field := range fields {
+		if value, ok := field.(*int); ok {
+			field = int64(*value)
+		}
+
+		if err := binary.Write(w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reads back the fields written by WriteState
+func ReadState(r io.Reader, fields ...any) error {
+	for _, field := range fields {
+		if value, ok := field.(*int); ok {
+			var wide int64
+			if err := binary.Read(r, binary.LittleEndian, &wide); err != nil {
+				return err
+			}
+			*value = int(wide)
+			continue
+		}
+
+		if err := binary.Read(r, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CHR RAM is part of the state, CHR ROM isn't
+func chrStateFields(chr []byte, chrWritable bool) []any {
+	if chrWritable {
+		return []any{chr}
+	}
+
+	return nil
+}
@@ -1,16 +1,17 @@
 class CPUState:
-    def __init__(self, a, x, y, p, sp) -> None:
+    def __init__(self, a, x, y, p, sp, cyc) -> None:
         self.a = a
         self.x = x
         self.y = y
         self.p = p
         self.sp = sp
+        self.cyc = cyc
 
     def __str__(self) -> str:
-        return f"A: {self.a:2x} X: {self.x:2x} Y: {self.y:2x} P: {self.p:2x} SP: {self.sp:2x}"
+        return f"A: {self.a:2x} X: {self.x:2x} Y: {self.y:2x} P: {self.p:2x} SP: {self.sp:2x} CYC: {self.cyc}"
 
     def __eq__(self, value: object) -> bool:
-        return self.a == value.a and self.x == value.x and self.y == value.y and self.p == value.p and self.sp == value.sp
+        return self.a == value.a and self.x == value.x and self.y == value.y and self.p == value.p and self.sp == value.sp and self.cyc == value.cyc
 
 nestest_states = []
 
@@ -21,7 +22,8 @@ with open("nestest.log") as nestest_log_file:
         y = int(line[60:62], 16)
         p = int(line[65:67], 16)
         sp = int(line[71:73], 16)
-        nestest_states.append(CPUState(a, x, y, p, sp))
+        cyc = int(line.split("CYC:")[1])
+        nestest_states.append(CPUState(a, x, y, p, sp, cyc))
 
 cpu_states = []
 with open("instructions.log") as log_file:
@@ -31,7 +33,8 @@ with open("instructions.log") as log_file:
         y = int(line[35:37].strip(), 16)
         p = int(line[40:42].strip(), 16)
         sp = int(line[46:48].strip(), 16)
-        cpu_states.append(CPUState(a, x, y, p, sp))
+        cyc = int(line.split("CYC:")[1].split()[0])
+        cpu_states.append(CPUState(a, x, y, p, sp, cyc))
 
 
 for i in range(min(len(nestest_states), len(cpu_states))):
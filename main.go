@@ -2,16 +2,33 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"nes-go/apu"
+	"nes-go/console"
 	"nes-go/disassembler"
-	"nes-go/emulator"
-	"nes-go/mos6502"
+	"nes-go/movie"
 	"nes-go/ppu"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		if err := runHeadless(os.Args[2:]); err != nil {
+			log.Fatalf("Error running headless: %v", err)
+		}
+		return
+	}
+
 	disassemble_activated := flag.Bool("disassemble", false, "Run disassembler")
+	trace_activated := flag.Bool("trace", false, "Log every executed instruction to instructions.log")
+	start_address := flag.String("start", "", "Start running at this hex address instead of the reset vector, like C000 for the nestest automated mode")
+	record_audio := flag.String("record-audio", "", "Run without a window, writing the audio to this WAV file")
+	frames := flag.Int("frames", 3600, "Frames to run when recording audio")
 	flag.Parse()
 
 	flag_tail := flag.Args()
@@ -24,28 +41,188 @@ func main() {
 		rom_path = flag_tail[0]
 	}
 
-	cart, err := os.ReadFile(rom_path)
+	nes, err := console.LoadROM(rom_path)
 
 	if err != nil {
-		log.Fatalf("Error reading cartridge: %v", err)
+		log.Fatalf("Error loading cartridge: %v", err)
+	}
+
+	if *start_address != "" {
+		pc, err := strconv.ParseUint(*start_address, 16, 16)
+
+		if err != nil {
+			log.Fatalf("Invalid start address %v: %v", *start_address, err)
+		}
+
+		nes.Cpu.Pc = uint16(pc)
 	}
 
-	rom := emulator.NewRom(cart)
-	memory := emulator.NewMemory(rom)
+	nes.Cpu.Trace = *trace_activated
+	interrupted := stopOnInterrupt(nes)
+
+	if *record_audio != "" {
+		if err := recordAudio(nes, *record_audio, *frames); err != nil {
+			log.Fatalf("Error recording audio: %v", err)
+		}
+	} else {
+		run(nes, *disassemble_activated, interrupted)
+	}
+
+	saveBattery(nes)
+}
+
+func saveBattery(nes *console.Console) {
+	if err := nes.SaveBattery(); err != nil {
+		log.Fatalf("Error writing battery save: %v", err)
+	}
+}
+
+// Playing and the web disassembler only stop when interrupted, so the
+// first interrupt stops the console and closes the returned channel to
+// let them return and write the battery save. A second one kills the
+// process as usual
+func stopOnInterrupt(nes *console.Console) <-chan struct{} {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 
-	cpu := mos6502.NewCPU(memory)
+	interrupted := make(chan struct{})
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		nes.Stop()
+		close(interrupted)
+	}()
 
-	mppu := ppu.NewPPU(memory)
-	pt0 := mppu.GetPatternTable0()
-	pt1 := mppu.GetPatternTable1()
+	return interrupted
+}
+
+func run(nes *console.Console, disassemble bool, interrupted <-chan struct{}) {
+	pt0 := nes.Ppu.GetPatternTable0()
+	pt1 := nes.Ppu.GetPatternTable1()
 
 	ppu.GenerateImage("pt0.png", pt0)
 	ppu.GenerateImage("pt1.png", pt1)
 
-	if *disassemble_activated {
-		disassembler := disassembler.NewDisassembler(cpu)
-		disassembler.DisassembleWeb()
+	if disassemble {
+		disassembler := disassembler.NewDisassembler(nes)
+		if err := disassembler.DisassembleWeb(interrupted); err != nil {
+			log.Fatalf("Error serving the disassembler: %v", err)
+		}
 	} else {
-		cpu.Run()
+		nes.Run()
+		if nes.Cpu.Halted() {
+			log.Printf("CPU halted by a JAM opcode at $%04X: %v", nes.Cpu.Pc, nes.Cpu)
+		}
+	}
+}
+
+// Runs the given frames headless, writing the mixed APU output to a WAV file
+func recordAudio(nes *console.Console, path string, frames int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	wav, err := apu.NewWavWriter(file, nes.SampleRate())
+	if err != nil {
+		return err
+	}
+
+	for range frames {
+		if nes.Stopped() {
+			break
+		}
+
+		nes.StepFrame()
+		if _, err := io.Copy(wav, nes.Audio()); err != nil {
+			return err
+		}
+	}
+
+	if err := wav.Close(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// The run subcommand: boots a rom without a window, optionally playing a movie,
+// then saves the last frame and prints its hash, for golden image tests.
+// Battery saves are neither read nor written, so every run starts the same
+func runHeadless(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	frames := flags.Int("frames", 0, "Frames to run, the length of the movie by default")
+	screenshot := flags.String("screenshot", "", "Write the last frame to this PNG file")
+	print_hash := flags.Bool("hash", false, "Print a SHA-256 of the last frame and the RAM")
+	movie_path := flags.String("movie", "", "Play the input of this FM2 movie")
+	flags.Parse(args)
+
+	rom_path := "nestest.nes"
+	if flags.NArg() > 0 {
+		rom_path = flags.Arg(0)
+	}
+
+	cartridge, err := os.ReadFile(rom_path)
+	if err != nil {
+		return err
+	}
+
+	nes, err := console.New(cartridge)
+	if err != nil {
+		return err
+	}
+
+	var player *movie.Player
+	if *movie_path != "" {
+		player, err = loadMovie(nes, *movie_path)
+		if err != nil {
+			return err
+		}
+
+		if *frames == 0 {
+			*frames = len(player.Movie().Frames)
+		}
+	}
+
+	if *frames <= 0 {
+		return fmt.Errorf("-frames is needed without a movie")
 	}
+
+	for range *frames {
+		if player != nil && !player.Done() {
+			if _, err := player.StepFrame(); err != nil {
+				return err
+			}
+		} else {
+			nes.StepFrame()
+		}
+	}
+
+	if *screenshot != "" {
+		if err := ppu.WritePng(*screenshot, nes.Frame()); err != nil {
+			return err
+		}
+	}
+
+	if *print_hash {
+		fmt.Printf("%x\n", nes.Hash())
+	}
+
+	return nil
+}
+
+func loadMovie(nes *console.Console, path string) (*movie.Player, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fm2, err := movie.Read(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return movie.NewPlayer(nes, fm2)
 }
@@ -2,6 +2,7 @@ package mos6502
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"nes-go/emulator"
 )
@@ -24,8 +25,22 @@ const (
 	Indirect
 	IndirectX
 	IndirectY
+	Implied
+	Accumulator
+	Relative
 )
 
+func (am AdressingMode) OperandSize() uint16 {
+	switch am {
+	case Implied, Accumulator:
+		return 0
+	case Absolute, AbsoluteX, AbsoluteY, Indirect:
+		return 2
+	}
+
+	return 1
+}
+
 type Flag byte
 
 const (
@@ -39,35 +54,156 @@ const (
 	FlagNegative
 )
 
+const (
+	NMI_VECTOR   = 0xfffa
+	RESET_VECTOR = 0xfffc
+	IRQ_VECTOR   = 0xfffe
+
+	RESET_CYCLES     = 7
+	INTERRUPT_CYCLES = 7
+)
+
 type CPU struct {
-	a   byte
-	x   byte
-	y   byte
-	Pc  uint16
-	sp  byte
-	p   byte
-	Mem *emulator.Memory
+	a      byte
+	x      byte
+	y      byte
+	Pc     uint16
+	sp     byte
+	p      byte
+	Cycles uint64
+	Mem    *emulator.Memory
+
+	// Logs every executed instruction and a memory dump, in the
+	// format expected by log_test.py
+	Trace bool
+
+	pageCrossed bool
+
+	nmiLine    bool
+	nmiPending bool
+	irqLine    bool
+
+	halted bool
 }
 
+// Starts in nestest automation mode, with the PC hard-coded to $C000
 func NewCPU(memory *emulator.Memory) *CPU {
 	return &CPU{
-		p:   0x24,
-		Pc:  0xc000,
-		sp:  0xfd,
+		p:      0x24,
+		Pc:     0xc000,
+		sp:     0xfd,
+		Cycles: RESET_CYCLES,
+		Mem:    memory,
+	}
+}
+
+// Starts like the real console at power on, running the reset sequence
+func NewCPUFromReset(memory *emulator.Memory) *CPU {
+	cpu := &CPU{
+		p:   0x20,
 		Mem: memory,
 	}
+	cpu.Reset()
+
+	return cpu
 }
 
 func (cpu *CPU) Step() {
-	instruction := cpu.GetNextInstruction()
-	cpu.Pc = instruction.Pc + 1
-	instruction.Run(cpu)
+	if cpu.halted {
+		return
+	}
+
+	if cpu.serviceInterrupts() {
+		return
+	}
+
+	if cpu.Trace {
+		cpu.trace()
+	}
+
+	// Devices on the bus, like the PPU, catch up to this cycle when accessed
+	cpu.Mem.CpuCycle = cpu.Cycles
+	cpu.execute(&opcodeTable[cpu.nextInstruction()])
+
+	// DMA transfers started by the instruction halt the CPU until they finish
+	cpu.Cycles += cpu.Mem.StallCycles
+	cpu.Mem.StallCycles = 0
+}
+
+func (cpu *CPU) trace() {
+	instructions_logger := emulator.GetInstructionsLogger()
+	memory_dump_logger := emulator.GetMemoryDumpLogger()
+
+	instruction := cpu.Disassemble(cpu.Pc)
+	instructions_logger.Printf("[PC: %04X] OPCODE %02X | %v | %v", instruction.Pc, instruction.Opcode, cpu, instruction.InstructionText)
+	memory_dump_logger.Printf("[PC: %04X]\n%v", instruction.Pc, cpu.Dump())
+}
+
+// The reset line doesn't write to the stack, but the stack pointer is
+// still decremented as if the PC and P had been pushed
+func (cpu *CPU) Reset() {
+	cpu.sp -= 3
+	cpu.setFlag(FlagInterruptDisable, true)
+	cpu.nmiPending = false
+	cpu.halted = false
+	cpu.Pc = cpu.readAddr(RESET_VECTOR)
+	cpu.Cycles += RESET_CYCLES
+}
+
+// NMI is edge triggered: it's only raised when the line goes from inactive to active
+func (cpu *CPU) SetNMI(active bool) {
+	if active && !cpu.nmiLine {
+		cpu.nmiPending = true
+	}
+	cpu.nmiLine = active
+}
+
+func (cpu *CPU) TriggerNMI() {
+	cpu.SetNMI(true)
+	cpu.SetNMI(false)
+}
+
+// IRQ is level triggered: it keeps firing while the line is active
+// and the interrupt disable flag is clear
+func (cpu *CPU) SetIRQ(active bool) {
+	cpu.irqLine = active
+}
+
+func (cpu *CPU) serviceInterrupts() bool {
+	if cpu.nmiPending {
+		cpu.nmiPending = false
+		cpu.interrupt(NMI_VECTOR)
+		return true
+	}
+
+	if cpu.irqLine && !cpu.getFlag(FlagInterruptDisable) {
+		cpu.interrupt(IRQ_VECTOR)
+		return true
+	}
+
+	return false
+}
+
+// Hardware interrupts push P with the B flag clear, unlike BRK and PHP
+func (cpu *CPU) interrupt(vector uint16) {
+	cpu.stackPushCurrentPc(0)
+	cpu.stackPush((cpu.p | 0x20) &^ FlagB)
+	cpu.setFlag(FlagInterruptDisable, true)
+	cpu.Pc = cpu.readAddr(vector)
+	cpu.Cycles += INTERRUPT_CYCLES
 }
 
 func (cpu *CPU) Run() {
-	for {
+	for !cpu.halted {
 		cpu.Step()
 	}
+
+	log.Printf("CPU halted by a JAM opcode at $%04X: %v", cpu.Pc, cpu)
+}
+
+// A JAM opcode locks the CPU until the next reset
+func (cpu *CPU) Halted() bool {
+	return cpu.halted
 }
 
 func (cpu *CPU) nextInstruction() byte {
@@ -152,11 +288,20 @@ func (cpu *CPU) compare(val1, val2 byte) {
 }
 
 func (cpu *CPU) branchJump(displacement int8) {
+	prev := cpu.Pc
+
 	if displacement < 0 {
 		cpu.Pc -= uint16(uint8(-displacement))
 	} else {
 		cpu.Pc += uint16(displacement)
 	}
+
+	// A taken branch costs one extra cycle, and another one
+	// if the destination is in a different page
+	cpu.Cycles += 1
+	if pagesDiffer(prev, cpu.Pc) {
+		cpu.Cycles += 1
+	}
 }
 
 func (cpu *CPU) nextAddrHelper() uint16 {
@@ -166,6 +311,8 @@ func (cpu *CPU) nextAddrHelper() uint16 {
 }
 
 func (cpu *CPU) nextAddress(am AdressingMode) (addr, originalAddr uint16) {
+	cpu.pageCrossed = false
+
 	switch am {
 	case ZeroPage:
 		originalAddr = uint16(cpu.nextInstruction())
@@ -180,11 +327,15 @@ func (cpu *CPU) nextAddress(am AdressingMode) (addr, originalAddr uint16) {
 		originalAddr = cpu.nextAddrHelper()
 		addr = originalAddr
 	case AbsoluteX:
-		originalAddr = cpu.nextAddrHelper() + uint16(cpu.x)
+		base := cpu.nextAddrHelper()
+		originalAddr = base + uint16(cpu.x)
 		addr = originalAddr
+		cpu.pageCrossed = pagesDiffer(base, addr)
 	case AbsoluteY:
-		originalAddr = cpu.nextAddrHelper() + uint16(cpu.y)
+		base := cpu.nextAddrHelper()
+		originalAddr = base + uint16(cpu.y)
 		addr = originalAddr
+		cpu.pageCrossed = pagesDiffer(base, addr)
 	case IndirectX:
 		addr, originalAddr = cpu.nextAddress(ZeroPageX)
 		addr_1_b, _ := cpu.Mem.ReadCpu(addr)
@@ -194,7 +345,9 @@ func (cpu *CPU) nextAddress(am AdressingMode) (addr, originalAddr uint16) {
 		addr, originalAddr = cpu.nextAddress(ZeroPage)
 		addr_1_b, _ := cpu.Mem.ReadCpu(addr)
 		addr_2_b, _ := cpu.Mem.ReadCpu((addr + 1) % ZERO_PAGE_SIZE)
-		addr = uint16(addr_1_b) + uint16(addr_2_b)<<BYTE_SIZE + uint16(cpu.y)
+		base := uint16(addr_1_b) + uint16(addr_2_b)<<BYTE_SIZE
+		addr = base + uint16(cpu.y)
+		cpu.pageCrossed = pagesDiffer(base, addr)
 	case Indirect:
 		originalAddr = cpu.nextAddrHelper()
 		addr_1_b, _ := cpu.Mem.ReadCpu(originalAddr)
@@ -211,7 +364,8 @@ func (cpu *CPU) nextAddress(am AdressingMode) (addr, originalAddr uint16) {
 }
 
 func (cpu *CPU) nextValue(am AdressingMode) (val byte, originalAddr uint16) {
-	if am == Immediate {
+	if am == Immediate || am == Relative {
+		cpu.pageCrossed = false
 		val = cpu.nextInstruction()
 		return
 	}
@@ -230,6 +384,7 @@ func (cpu *CPU) nextValue(am AdressingMode) (val byte, originalAddr uint16) {
 }
 
 func (cpu *CPU) write(val byte, addr uint16) {
+	cpu.Mem.CpuCycle = cpu.Cycles
 	err := cpu.Mem.WriteCpu(val, addr)
 
 	if err != nil {
@@ -237,6 +392,19 @@ func (cpu *CPU) write(val byte, addr uint16) {
 	}
 }
 
+// Read-modify-write instructions write back the unmodified value
+// before writing the result, which is visible to mappers and registers
+func (cpu *CPU) dummyWrite(val byte, addr uint16) {
+	cpu.write(val, addr)
+}
+
+func (cpu *CPU) readAddr(addr uint16) uint16 {
+	low := uint16(cpu.read(addr))
+	high := uint16(cpu.read(addr + 1))
+
+	return high<<BYTE_SIZE + low
+}
+
 func (cpu *CPU) read(addr uint16) byte {
 	val, err := cpu.Mem.ReadCpu(addr)
 
@@ -252,7 +420,7 @@ func (cpu CPU) Dump() *emulator.MemoryDump {
 }
 
 func (cpu CPU) String() string {
-	return fmt.Sprintf("A:%02X X:%02X Y:%02X P:%02X SP:%02X", cpu.a, cpu.x, cpu.y, cpu.p, cpu.sp)
+	return fmt.Sprintf("A:%02X X:%02X Y:%02X P:%02X SP:%02X CYC:%d", cpu.a, cpu.x, cpu.y, cpu.p, cpu.sp, cpu.Cycles)
 }
 
 type FlagData struct {
@@ -266,21 +434,25 @@ type FlagData struct {
 }
 
 type StateData struct {
-	PC    uint16
-	A     byte
-	X     byte
-	Y     byte
-	SP    byte
-	Flags FlagData
+	PC     uint16
+	A      byte
+	X      byte
+	Y      byte
+	SP     byte
+	Cycles uint64
+	Halted bool
+	Flags  FlagData
 }
 
 func (cpu CPU) GetStateData() StateData {
 	return StateData{
-		PC: cpu.Pc,
-		A:  cpu.a,
-		X:  cpu.x,
-		Y:  cpu.y,
-		SP: cpu.sp,
+		PC:     cpu.Pc,
+		A:      cpu.a,
+		X:      cpu.x,
+		Y:      cpu.y,
+		SP:     cpu.sp,
+		Cycles: cpu.Cycles,
+		Halted: cpu.halted,
 		Flags: FlagData{
 			Carry:            cpu.getFlag(FlagCarry),
 			Zero:             cpu.getFlag(FlagZero),
@@ -292,3 +464,19 @@ func (cpu CPU) GetStateData() StateData {
 		},
 	}
 }
+
+// Registers, cycle count and interrupt lines
+func (cpu *CPU) stateFields() []any {
+	return []any{
+		&cpu.a, &cpu.x, &cpu.y, &cpu.Pc, &cpu.sp, &cpu.p, &cpu.Cycles,
+		&cpu.nmiLine, &cpu.nmiPending, &cpu.irqLine, &cpu.halted,
+	}
+}
+
+func (cpu *CPU) SaveState(w io.Writer) error {
+	return emulator.WriteState(w, cpu.stateFields()...)
+}
+
+func (cpu *CPU) LoadState(r io.Reader) error {
+	return emulator.ReadState(r, cpu.stateFields()...)
+}
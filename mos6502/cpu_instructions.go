@@ -1,15 +1,19 @@
 package mos6502
 
+// BRK is two bytes long: the byte after the opcode is skipped on return
 func (cpu *CPU) brk() {
-	cpu.stackPushCurrentPc(2)
+	cpu.stackPushCurrentPc(1)
 	cpu.stackPush(cpu.p | FlagB)
+	cpu.setFlag(FlagInterruptDisable, true)
 
-	addr1, _ := cpu.Mem.ReadCpu(0xfffe)
-	addr2, _ := cpu.Mem.ReadCpu(0xffff)
-
-	cpu.Pc = (uint16(addr1) << 8) + uint16(addr2)
+	cpu.Pc = cpu.readAddr(IRQ_VECTOR)
 }
 
+func (cpu *CPU) nop() {}
+
+// Unofficial NOPs that read their operand
+func (cpu *CPU) nopRead(val byte) {}
+
 func (cpu *CPU) rti() {
 	cpu.p = (cpu.stackPull() | 0x20) & 0xef
 	cpu.Pc = cpu.stackPullAddr()
@@ -156,9 +160,18 @@ func (cpu *CPU) cpy(val byte) {
 }
 
 func (cpu *CPU) inc(addr uint16) {
-	val := cpu.read(addr) + 1
+	cpu.incMemory(addr)
+}
+
+// Read-modify-write helpers return the value written, which the
+// unofficial opcodes combining them with ALU operations use
+func (cpu *CPU) incMemory(addr uint16) byte {
+	val := cpu.read(addr)
+	cpu.dummyWrite(val, addr)
+	val += 1
 	cpu.assignBasicFlags(val)
 	cpu.write(val, addr)
+	return val
 }
 
 func (cpu *CPU) inx() {
@@ -172,9 +185,16 @@ func (cpu *CPU) iny() {
 }
 
 func (cpu *CPU) dec(addr uint16) {
-	val := cpu.read(addr) - 1
+	cpu.decMemory(addr)
+}
+
+func (cpu *CPU) decMemory(addr uint16) byte {
+	val := cpu.read(addr)
+	cpu.dummyWrite(val, addr)
+	val -= 1
 	cpu.assignBasicFlags(val)
 	cpu.write(val, addr)
+	return val
 }
 
 func (cpu *CPU) dex() {
@@ -194,7 +214,12 @@ func (cpu *CPU) asl_acc() {
 }
 
 func (cpu *CPU) asl(addr uint16) {
+	cpu.aslMemory(addr)
+}
+
+func (cpu *CPU) aslMemory(addr uint16) byte {
 	val := cpu.read(addr)
+	cpu.dummyWrite(val, addr)
 
 	cpu.setFlag(FlagCarry, val&0x80 == 0x80)
 
@@ -202,6 +227,7 @@ func (cpu *CPU) asl(addr uint16) {
 
 	cpu.assignBasicFlags(val)
 	cpu.write(val, addr)
+	return val
 }
 
 func (cpu *CPU) lsr_acc() {
@@ -211,7 +237,12 @@ func (cpu *CPU) lsr_acc() {
 }
 
 func (cpu *CPU) lsr(addr uint16) {
+	cpu.lsrMemory(addr)
+}
+
+func (cpu *CPU) lsrMemory(addr uint16) byte {
 	val := cpu.read(addr)
+	cpu.dummyWrite(val, addr)
 
 	cpu.setFlag(FlagCarry, val&0x01 == 0x01)
 
@@ -219,6 +250,7 @@ func (cpu *CPU) lsr(addr uint16) {
 
 	cpu.assignBasicFlags(val)
 	cpu.write(val, addr)
+	return val
 }
 
 func (cpu *CPU) rol_acc() {
@@ -232,7 +264,12 @@ func (cpu *CPU) rol_acc() {
 }
 
 func (cpu *CPU) rol(addr uint16) {
+	cpu.rolMemory(addr)
+}
+
+func (cpu *CPU) rolMemory(addr uint16) byte {
 	val := cpu.read(addr)
+	cpu.dummyWrite(val, addr)
 
 	prev_carry := cpu.getFlag(FlagCarry)
 	cpu.setFlag(FlagCarry, isNegative(val))
@@ -244,6 +281,7 @@ func (cpu *CPU) rol(addr uint16) {
 
 	cpu.assignBasicFlags(val)
 	cpu.write(val, addr)
+	return val
 }
 
 func (cpu *CPU) ror_acc() {
@@ -257,7 +295,12 @@ func (cpu *CPU) ror_acc() {
 }
 
 func (cpu *CPU) ror(addr uint16) {
+	cpu.rorMemory(addr)
+}
+
+func (cpu *CPU) rorMemory(addr uint16) byte {
 	val := cpu.read(addr)
+	cpu.dummyWrite(val, addr)
 
 	prev_carry := cpu.getFlag(FlagCarry)
 	cpu.setFlag(FlagCarry, val&0x01 == 0x01)
@@ -269,6 +312,7 @@ func (cpu *CPU) ror(addr uint16) {
 
 	cpu.assignBasicFlags(val)
 	cpu.write(val, addr)
+	return val
 }
 
 func (cpu *CPU) jmp(addr uint16) {
@@ -0,0 +1,120 @@
+package mos6502
+
+const (
+	// Magic constants of the unstable LXA and XAA opcodes. They depend
+	// on the chip, these are the values observed on most NES consoles
+	LXA_MAGIC = 0xff
+	XAA_MAGIC = 0xee
+)
+
+func (cpu *CPU) jam() {
+	cpu.Pc -= 1
+	cpu.halted = true
+}
+
+func (cpu *CPU) lax(val byte) {
+	cpu.lda(val)
+	cpu.x = cpu.a
+}
+
+func (cpu *CPU) sax(addr uint16) {
+	cpu.write(cpu.a&cpu.x, addr)
+}
+
+func (cpu *CPU) dcp(addr uint16) {
+	cpu.cmp(cpu.decMemory(addr))
+}
+
+func (cpu *CPU) isb(addr uint16) {
+	cpu.sbc(cpu.incMemory(addr))
+}
+
+func (cpu *CPU) slo(addr uint16) {
+	cpu.ora(cpu.aslMemory(addr))
+}
+
+func (cpu *CPU) rla(addr uint16) {
+	cpu.and(cpu.rolMemory(addr))
+}
+
+func (cpu *CPU) sre(addr uint16) {
+	cpu.eor(cpu.lsrMemory(addr))
+}
+
+func (cpu *CPU) rra(addr uint16) {
+	cpu.adc(cpu.rorMemory(addr))
+}
+
+func (cpu *CPU) anc(val byte) {
+	cpu.and(val)
+	cpu.setFlag(FlagCarry, isNegative(cpu.a))
+}
+
+func (cpu *CPU) alr(val byte) {
+	cpu.and(val)
+	cpu.lsr_acc()
+}
+
+func (cpu *CPU) arr(val byte) {
+	cpu.a &= val
+	cpu.ror_acc()
+
+	bit6 := cpu.a&0x40 != 0
+	bit5 := cpu.a&0x20 != 0
+	cpu.setFlag(FlagCarry, bit6)
+	cpu.setFlag(FlagOverflow, bit6 != bit5)
+}
+
+func (cpu *CPU) axs(val byte) {
+	ax := cpu.a & cpu.x
+	cpu.x = ax - val
+	cpu.setFlag(FlagCarry, ax >= val)
+	cpu.assignBasicFlags(cpu.x)
+}
+
+func (cpu *CPU) lxa(val byte) {
+	cpu.lax((cpu.a | LXA_MAGIC) & val)
+}
+
+func (cpu *CPU) xaa(val byte) {
+	cpu.a = (cpu.a | XAA_MAGIC) & cpu.x & val
+	cpu.assignBasicFlags(cpu.a)
+}
+
+func (cpu *CPU) las(val byte) {
+	cpu.sp &= val
+	cpu.a = cpu.sp
+	cpu.x = cpu.sp
+	cpu.assignBasicFlags(cpu.a)
+}
+
+// SHA, SHX, SHY and TAS store the value ANDed with the high byte of the
+// base address plus one. When the indexing crosses a page, the high byte
+// of the target address gets replaced by the stored value
+func (cpu *CPU) unstableStore(val byte, addr uint16, index byte) {
+	base := addr - uint16(index)
+	val &= byte(base>>BYTE_SIZE) + 1
+
+	if pagesDiffer(base, addr) {
+		addr = uint16(val)<<BYTE_SIZE | addr&0x00ff
+	}
+
+	cpu.write(val, addr)
+}
+
+func (cpu *CPU) sha(addr uint16) {
+	cpu.unstableStore(cpu.a&cpu.x, addr, cpu.y)
+}
+
+func (cpu *CPU) shx(addr uint16) {
+	cpu.unstableStore(cpu.x, addr, cpu.y)
+}
+
+func (cpu *CPU) shy(addr uint16) {
+	cpu.unstableStore(cpu.y, addr, cpu.x)
+}
+
+func (cpu *CPU) tas(addr uint16) {
+	cpu.sp = cpu.a & cpu.x
+	cpu.unstableStore(cpu.sp, addr, cpu.y)
+}
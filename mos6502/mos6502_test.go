@@ -1,8 +1,12 @@
 package mos6502
 
 import (
+	"bufio"
+	"fmt"
 	"nes-go/emulator"
+	"os"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -44,13 +48,16 @@ func TestSubOverflow(t *testing.T) {
 
 func getEmptyRom() *emulator.Rom {
 	rom_data := slices.Repeat([]byte{0}, 16400)
+	copy(rom_data, emulator.INES_MAGIC)
 	rom_data[4] = 1
-	return emulator.NewRom(rom_data)
+
+	rom, _ := emulator.NewRom(rom_data)
+	return rom
 }
 
 func TestMemoryRead(t *testing.T) {
 	rom := getEmptyRom()
-	mem := emulator.NewMemory(rom)
+	mem, _ := emulator.NewMemory(rom)
 
 	var addr uint16
 	var val byte = 0xaa
@@ -66,7 +73,7 @@ func TestMemoryRead(t *testing.T) {
 	assert.Equal(t, val, out)
 
 	mem.RomData.PrgData[0x50] = val
-	addr = emulator.CPU_MEMORY_SIZE + 0x50
+	addr = emulator.PRG_ROM_START + 0x50
 
 	out, err = mem.ReadCpu(addr)
 	assert.Nil(t, err)
@@ -75,7 +82,7 @@ func TestMemoryRead(t *testing.T) {
 
 func TestMemoryWrite(t *testing.T) {
 	rom := getEmptyRom()
-	mem := emulator.NewMemory(rom)
+	mem, _ := emulator.NewMemory(rom)
 
 	var addr uint16
 	var val byte = 0xaa
@@ -88,16 +95,17 @@ func TestMemoryWrite(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, val, mem.CPUData[addr])
 
-	addr = emulator.CPU_MEMORY_SIZE + 0x50
+	addr = emulator.PRG_ROM_START + 0x50
 
+	// PRG ROM is read only
 	err = mem.WriteCpu(val, addr)
 	assert.Nil(t, err)
-	assert.Equal(t, val, mem.RomData.PrgData[0x50])
+	assert.Equal(t, byte(0x00), mem.RomData.PrgData[0x50])
 }
 
 func TestRor(t *testing.T) {
 	rom := getEmptyRom()
-	mem := emulator.NewMemory(rom)
+	mem, _ := emulator.NewMemory(rom)
 	cpu := NewCPU(mem)
 
 	var addr uint16 = 0x50
@@ -142,7 +150,7 @@ func TestRor(t *testing.T) {
 
 func TestRol(t *testing.T) {
 	rom := getEmptyRom()
-	mem := emulator.NewMemory(rom)
+	mem, _ := emulator.NewMemory(rom)
 	cpu := NewCPU(mem)
 
 	var addr uint16 = 0x50
@@ -187,7 +195,7 @@ func TestRol(t *testing.T) {
 
 func TestLsr(t *testing.T) {
 	rom := getEmptyRom()
-	mem := emulator.NewMemory(rom)
+	mem, _ := emulator.NewMemory(rom)
 	cpu := NewCPU(mem)
 
 	var addr uint16 = 0x50
@@ -226,7 +234,7 @@ func TestLsr(t *testing.T) {
 
 func TestAsl(t *testing.T) {
 	rom := getEmptyRom()
-	mem := emulator.NewMemory(rom)
+	mem, _ := emulator.NewMemory(rom)
 	cpu := NewCPU(mem)
 
 	var addr uint16 = 0x50
@@ -265,7 +273,7 @@ func TestAsl(t *testing.T) {
 
 func TestIndirectXAddressing(t *testing.T) {
 	rom := getEmptyRom()
-	mem := emulator.NewMemory(rom)
+	mem, _ := emulator.NewMemory(rom)
 	cpu := NewCPU(mem)
 
 	cpu.write(0x00, 0)
@@ -274,3 +282,399 @@ func TestIndirectXAddressing(t *testing.T) {
 	out, _ := cpu.nextAddress(IndirectX)
 	assert.Equal(t, uint16(0x0200), out)
 }
+
+type nestestState struct {
+	pc     uint16
+	a      byte
+	x      byte
+	y      byte
+	p      byte
+	sp     byte
+	cycles uint64
+}
+
+func parseNestestLog(t *testing.T) []nestestState {
+	file, err := os.Open("../nestest.log")
+	if err != nil {
+		t.Skipf("nestest.log not found: %v", err)
+	}
+	defer file.Close()
+
+	var states []nestestState
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		var state nestestState
+		fmt.Sscanf(line[0:4], "%X", &state.pc)
+		fmt.Sscanf(line[48:73], "A:%X X:%X Y:%X P:%X SP:%X", &state.a, &state.x, &state.y, &state.p, &state.sp)
+		fmt.Sscanf(line[strings.Index(line, "CYC:"):], "CYC:%d", &state.cycles)
+
+		states = append(states, state)
+	}
+
+	return states
+}
+
+func loadNestest(t *testing.T) *CPU {
+	cart, err := os.ReadFile("../nestest.nes")
+	if err != nil {
+		t.Skipf("nestest.nes not found: %v", err)
+	}
+
+	rom, err := emulator.NewRom(cart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem, err := emulator.NewMemory(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewCPU(mem)
+}
+
+func TestNestest(t *testing.T) {
+	states := parseNestestLog(t)
+	cpu := loadNestest(t)
+
+	for i, expected := range states {
+		actual := nestestState{cpu.Pc, cpu.a, cpu.x, cpu.y, cpu.p, cpu.sp, cpu.Cycles}
+		if !assert.Equal(t, expected, actual, "nestest.log line %d", i+1) {
+			return
+		}
+
+		cpu.Step()
+	}
+
+	// nestest stores its error codes in $02 and $03
+	assert.Equal(t, byte(0x00), cpu.read(0x02))
+	assert.Equal(t, byte(0x00), cpu.read(0x03))
+}
+
+// Vectors are in PRG ROM, so they have to be set in the cartridge data
+func setVector(cpu *CPU, vector, addr uint16) {
+	prg := cpu.Mem.RomData.PrgData
+	offset := int(vector-emulator.PRG_ROM_START) % len(prg)
+
+	prg[offset] = byte(addr & 0xff)
+	prg[offset+1] = byte(addr >> BYTE_SIZE)
+}
+
+func TestReset(t *testing.T) {
+	mem, _ := emulator.NewMemory(getEmptyRom())
+	cpu := NewCPU(mem)
+	setVector(cpu, RESET_VECTOR, 0x8123)
+
+	cpu = NewCPUFromReset(mem)
+
+	assert.Equal(t, uint16(0x8123), cpu.Pc)
+	assert.Equal(t, byte(0xfd), cpu.sp)
+	assert.Equal(t, uint64(RESET_CYCLES), cpu.Cycles)
+	assert.True(t, cpu.getFlag(FlagInterruptDisable))
+}
+
+func TestNMI(t *testing.T) {
+	mem, _ := emulator.NewMemory(getEmptyRom())
+	cpu := NewCPU(mem)
+	setVector(cpu, NMI_VECTOR, 0x0300)
+	cpu.write(0xea, 0x0300) // NOP
+
+	cpu.Pc = 0x0200
+	cpu.SetNMI(true)
+	cpu.Step()
+
+	assert.Equal(t, uint16(0x0300), cpu.Pc)
+	assert.Equal(t, uint64(RESET_CYCLES+INTERRUPT_CYCLES), cpu.Cycles)
+	assert.True(t, cpu.getFlag(FlagInterruptDisable))
+
+	p := cpu.stackPull()
+	assert.Equal(t, byte(0x00), p&FlagB)
+	assert.Equal(t, uint16(0x0200), cpu.stackPullAddr())
+
+	// Keeping the line active doesn't trigger another NMI
+	cpu.Step()
+	assert.Equal(t, uint16(0x0301), cpu.Pc)
+}
+
+func TestIRQ(t *testing.T) {
+	mem, _ := emulator.NewMemory(getEmptyRom())
+	cpu := NewCPU(mem)
+	setVector(cpu, IRQ_VECTOR, 0x9000)
+	cpu.write(0xea, 0x0200) // NOP
+
+	cpu.Pc = 0x0200
+	cpu.setFlag(FlagInterruptDisable, true)
+	cpu.SetIRQ(true)
+	cpu.Step()
+	assert.Equal(t, uint16(0x0201), cpu.Pc)
+
+	cpu.setFlag(FlagInterruptDisable, false)
+	cpu.Step()
+	assert.Equal(t, uint16(0x9000), cpu.Pc)
+	assert.True(t, cpu.getFlag(FlagInterruptDisable))
+}
+
+func TestBrk(t *testing.T) {
+	mem, _ := emulator.NewMemory(getEmptyRom())
+	cpu := NewCPU(mem)
+	setVector(cpu, IRQ_VECTOR, 0x9000)
+	cpu.write(0x00, 0x0200) // BRK
+
+	cpu.Pc = 0x0200
+	cpu.Step()
+	assert.Equal(t, uint16(0x9000), cpu.Pc)
+
+	p := cpu.stackPull()
+	assert.Equal(t, byte(FlagB), p&FlagB)
+	assert.Equal(t, uint16(0x0202), cpu.stackPullAddr())
+}
+
+func TestOpcodeTable(t *testing.T) {
+	for opcode, op := range opcodeTable {
+		handlers := 0
+		if op.implied != nil {
+			handlers++
+		}
+		if op.value != nil {
+			handlers++
+		}
+		if op.address != nil {
+			handlers++
+		}
+
+		assert.NotEmpty(t, op.Mnemonic, "opcode %02X", opcode)
+		assert.NotZero(t, op.Cycles, "opcode %02X", opcode)
+		assert.Equal(t, 1, handlers, "opcode %02X", opcode)
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	mem, _ := emulator.NewMemory(getEmptyRom())
+	cpu := NewCPU(mem)
+
+	program := []byte{
+		0xbd, 0x34, 0x12, // LDA $1234, X
+		0xd0, 0xfb, // BNE $0200
+		0xa7, 0x10, // *LAX $10
+		0x0a, // ASL A
+	}
+	for i, val := range program {
+		cpu.write(val, 0x0200+uint16(i))
+	}
+
+	expected := []string{"LDA $1234, X", "BNE $0200", "*LAX $10", "ASL A"}
+	pc := uint16(0x0200)
+	for _, text := range expected {
+		instruction := cpu.Disassemble(pc)
+		assert.Equal(t, text, instruction.InstructionText)
+		pc = instruction.NextPc
+	}
+
+	// Disassembling doesn't change the CPU state
+	assert.Equal(t, uint16(0xc000), cpu.Pc)
+	assert.Equal(t, uint64(RESET_CYCLES), cpu.Cycles)
+}
+
+func TestJam(t *testing.T) {
+	mem, _ := emulator.NewMemory(getEmptyRom())
+	cpu := NewCPU(mem)
+	setVector(cpu, RESET_VECTOR, 0x9000)
+	cpu.write(0x02, 0x0200) // JAM
+
+	cpu.Pc = 0x0200
+	cpu.Step()
+	assert.True(t, cpu.Halted())
+	assert.True(t, cpu.GetStateData().Halted)
+	assert.Equal(t, uint16(0x0200), cpu.Pc)
+
+	cpu.Step()
+	assert.Equal(t, uint16(0x0200), cpu.Pc)
+
+	cpu.Reset()
+	assert.False(t, cpu.Halted())
+	assert.Equal(t, uint16(0x9000), cpu.Pc)
+}
+
+func TestDmaStall(t *testing.T) {
+	mem, _ := emulator.NewMemory(getEmptyRom())
+	cpu := NewCPU(mem)
+	cpu.write(0xea, 0x0200) // NOP
+	cpu.Pc = 0x0200
+	cycles := cpu.Cycles
+
+	mem.StallCycles = 514
+	cpu.Step()
+	assert.Equal(t, cycles+2+514, cpu.Cycles)
+	assert.Zero(t, mem.StallCycles)
+}
+
+func TestAxs(t *testing.T) {
+	mem, _ := emulator.NewMemory(getEmptyRom())
+	cpu := NewCPU(mem)
+
+	cpu.a = 0xf0
+	cpu.x = 0x3c
+	cpu.axs(0x10)
+	assert.Equal(t, byte(0x20), cpu.x)
+	assert.True(t, cpu.getFlag(FlagCarry))
+
+	cpu.axs(0x30)
+	assert.Equal(t, byte(0xf0), cpu.x)
+	assert.False(t, cpu.getFlag(FlagCarry))
+	assert.True(t, cpu.getFlag(FlagNegative))
+}
+
+func TestArr(t *testing.T) {
+	mem, _ := emulator.NewMemory(getEmptyRom())
+	cpu := NewCPU(mem)
+
+	cpu.a = 0xff
+	cpu.setFlag(FlagCarry, true)
+	cpu.arr(0xc0)
+	assert.Equal(t, byte(0xe0), cpu.a)
+	assert.True(t, cpu.getFlag(FlagCarry))
+	assert.False(t, cpu.getFlag(FlagOverflow))
+
+	cpu.a = 0xff
+	cpu.setFlag(FlagCarry, false)
+	cpu.arr(0x80)
+	assert.Equal(t, byte(0x40), cpu.a)
+	assert.True(t, cpu.getFlag(FlagCarry))
+	assert.True(t, cpu.getFlag(FlagOverflow))
+}
+
+func TestUnstableStore(t *testing.T) {
+	mem, _ := emulator.NewMemory(getEmptyRom())
+	cpu := NewCPU(mem)
+
+	// No page crossed: the value is ANDed with the high byte + 1
+	cpu.x = 0xff
+	cpu.y = 0x10
+	cpu.shx(0x0210)
+	assert.Equal(t, byte(0x03), cpu.read(0x0210))
+
+	// Page crossed: the high byte of the address is replaced by the value
+	cpu.x = 0x05
+	cpu.y = 0x20
+	cpu.shx(0x0310)
+	assert.Equal(t, byte(0x01), cpu.read(0x0110))
+}
+
+func setupBenchmarkLoop(b *testing.B) *CPU {
+	mem, _ := emulator.NewMemory(getEmptyRom())
+	cpu := NewCPU(mem)
+
+	program := []byte{
+		0xb5, 0x10, // LDA $10, X
+		0x69, 0x01, // ADC #$01
+		0x9d, 0x00, 0x03, // STA $0300, X
+		0xe8,       // INX
+		0xd0, 0xf6, // BNE $0200
+		0x4c, 0x00, 0x02, // JMP $0200
+	}
+	for i, val := range program {
+		cpu.write(val, 0x0200+uint16(i))
+	}
+	cpu.Pc = 0x0200
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	return cpu
+}
+
+func BenchmarkStep(b *testing.B) {
+	cpu := setupBenchmarkLoop(b)
+
+	for range b.N {
+		cpu.Step()
+	}
+}
+
+// Loop over most addressing modes and kinds of instruction, so the
+// dispatch isn't measured on a handful of opcodes only
+func BenchmarkStepMixed(b *testing.B) {
+	mem, _ := emulator.NewMemory(getEmptyRom())
+	cpu := NewCPU(mem)
+
+	program := []byte{
+		0xb5, 0x10, // LDA $10, X
+		0x69, 0x01, // ADC #$01
+		0x9d, 0x00, 0x03, // STA $0300, X
+		0xa4, 0x20, // LDY $20
+		0x51, 0x30, // EOR ($30), Y
+		0x06, 0x40, // ASL $40
+		0x6a,             // ROR A
+		0xd9, 0x00, 0x04, // CMP $0400, Y
+		0x24, 0x50, // BIT $50
+		0x48,       // PHA
+		0x68,       // PLA
+		0xf6, 0x60, // INC $60, X
+		0x21, 0x70, // AND ($70, X)
+		0xa8,       // TAY
+		0xe9, 0x02, // SBC #$02
+		0x18,       // CLC
+		0xe8,       // INX
+		0xd0, 0xe0, // BNE $0200
+		0x4c, 0x00, 0x02, // JMP $0200
+	}
+	for i, val := range program {
+		cpu.write(val, 0x0200+uint16(i))
+	}
+	cpu.Pc = 0x0200
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		cpu.Step()
+	}
+}
+
+func BenchmarkDisassemble(b *testing.B) {
+	cpu := setupBenchmarkLoop(b)
+
+	for range b.N {
+		cpu.Disassemble(cpu.Pc)
+	}
+}
+
+// Register that counts its accesses, like the ones with read side effects
+type countingRegister struct {
+	value  byte
+	reads  int
+	writes int
+}
+
+func (register *countingRegister) Read(address uint16) byte {
+	register.reads++
+	return register.value
+}
+
+func (register *countingRegister) Write(value byte, address uint16) {
+	register.writes++
+	register.value = value
+}
+
+func TestReadModifyWriteAccesses(t *testing.T) {
+	mem, _ := emulator.NewMemory(getEmptyRom())
+	cpu := NewCPU(mem)
+
+	register := &countingRegister{value: 0x10}
+	assert.Nil(t, mem.AttachDevice(0x4018, 0x4018, register))
+
+	cpu.a = 0x0f
+	cpu.dcp(0x4018)
+	assert.Equal(t, byte(0x0f), register.value)
+	assert.True(t, cpu.getFlag(FlagZero))
+
+	for _, op := range []func(*CPU, uint16){(*CPU).isb, (*CPU).slo, (*CPU).rla, (*CPU).sre, (*CPU).rra} {
+		op(cpu, 0x4018)
+	}
+
+	// One read and the dummy and real writes each
+	assert.Equal(t, 6, register.reads)
+	assert.Equal(t, 12, register.writes)
+}
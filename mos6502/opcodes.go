@@ -0,0 +1,334 @@
+package mos6502
+
+import "fmt"
+
+type Opcode struct {
+	Mnemonic   string
+	Mode       AdressingMode
+	Cycles     byte
+	Unofficial bool
+
+	// Only one of the handlers is set, depending on what the
+	// instruction needs from its operand
+	implied func(*CPU)
+	value   func(*CPU, byte)
+	address func(*CPU, uint16)
+}
+
+func impliedOp(mnemonic string, am AdressingMode, cycles byte, handler func(*CPU)) Opcode {
+	return Opcode{Mnemonic: mnemonic, Mode: am, Cycles: cycles, implied: handler}
+}
+
+func valueOp(mnemonic string, am AdressingMode, cycles byte, handler func(*CPU, byte)) Opcode {
+	return Opcode{Mnemonic: mnemonic, Mode: am, Cycles: cycles, value: handler}
+}
+
+func addressOp(mnemonic string, am AdressingMode, cycles byte, handler func(*CPU, uint16)) Opcode {
+	return Opcode{Mnemonic: mnemonic, Mode: am, Cycles: cycles, address: handler}
+}
+
+func unofficial(opcode Opcode) Opcode {
+	opcode.Unofficial = true
+	return opcode
+}
+
+// Cycles are the base ones, without the page crossing and branch penalties
+var opcodeTable = [256]Opcode{
+	0x00: impliedOp("BRK", Implied, 7, (*CPU).brk),
+	0x01: valueOp("ORA", IndirectX, 6, (*CPU).ora),
+	0x02: unofficial(impliedOp("JAM", Implied, 2, (*CPU).jam)),
+	0x03: unofficial(addressOp("SLO", IndirectX, 8, (*CPU).slo)),
+	0x04: unofficial(valueOp("NOP", ZeroPage, 3, (*CPU).nopRead)),
+	0x05: valueOp("ORA", ZeroPage, 3, (*CPU).ora),
+	0x06: addressOp("ASL", ZeroPage, 5, (*CPU).asl),
+	0x07: unofficial(addressOp("SLO", ZeroPage, 5, (*CPU).slo)),
+	0x08: impliedOp("PHP", Implied, 3, (*CPU).php),
+	0x09: valueOp("ORA", Immediate, 2, (*CPU).ora),
+	0x0a: impliedOp("ASL", Accumulator, 2, (*CPU).asl_acc),
+	0x0b: unofficial(valueOp("ANC", Immediate, 2, (*CPU).anc)),
+	0x0c: unofficial(valueOp("NOP", Absolute, 4, (*CPU).nopRead)),
+	0x0d: valueOp("ORA", Absolute, 4, (*CPU).ora),
+	0x0e: addressOp("ASL", Absolute, 6, (*CPU).asl),
+	0x0f: unofficial(addressOp("SLO", Absolute, 6, (*CPU).slo)),
+	0x10: valueOp("BPL", Relative, 2, (*CPU).bpl),
+	0x11: valueOp("ORA", IndirectY, 5, (*CPU).ora),
+	0x12: unofficial(impliedOp("JAM", Implied, 2, (*CPU).jam)),
+	0x13: unofficial(addressOp("SLO", IndirectY, 8, (*CPU).slo)),
+	0x14: unofficial(valueOp("NOP", ZeroPageX, 4, (*CPU).nopRead)),
+	0x15: valueOp("ORA", ZeroPageX, 4, (*CPU).ora),
+	0x16: addressOp("ASL", ZeroPageX, 6, (*CPU).asl),
+	0x17: unofficial(addressOp("SLO", ZeroPageX, 6, (*CPU).slo)),
+	0x18: impliedOp("CLC", Implied, 2, (*CPU).clc),
+	0x19: valueOp("ORA", AbsoluteY, 4, (*CPU).ora),
+	0x1a: unofficial(impliedOp("NOP", Implied, 2, (*CPU).nop)),
+	0x1b: unofficial(addressOp("SLO", AbsoluteY, 7, (*CPU).slo)),
+	0x1c: unofficial(valueOp("NOP", AbsoluteX, 4, (*CPU).nopRead)),
+	0x1d: valueOp("ORA", AbsoluteX, 4, (*CPU).ora),
+	0x1e: addressOp("ASL", AbsoluteX, 7, (*CPU).asl),
+	0x1f: unofficial(addressOp("SLO", AbsoluteX, 7, (*CPU).slo)),
+	0x20: addressOp("JSR", Absolute, 6, (*CPU).jsr),
+	0x21: valueOp("AND", IndirectX, 6, (*CPU).and),
+	0x22: unofficial(impliedOp("JAM", Implied, 2, (*CPU).jam)),
+	0x23: unofficial(addressOp("RLA", IndirectX, 8, (*CPU).rla)),
+	0x24: valueOp("BIT", ZeroPage, 3, (*CPU).bit),
+	0x25: valueOp("AND", ZeroPage, 3, (*CPU).and),
+	0x26: addressOp("ROL", ZeroPage, 5, (*CPU).rol),
+	0x27: unofficial(addressOp("RLA", ZeroPage, 5, (*CPU).rla)),
+	0x28: impliedOp("PLP", Implied, 4, (*CPU).plp),
+	0x29: valueOp("AND", Immediate, 2, (*CPU).and),
+	0x2a: impliedOp("ROL", Accumulator, 2, (*CPU).rol_acc),
+	0x2b: unofficial(valueOp("ANC", Immediate, 2, (*CPU).anc)),
+	0x2c: valueOp("BIT", Absolute, 4, (*CPU).bit),
+	0x2d: valueOp("AND", Absolute, 4, (*CPU).and),
+	0x2e: addressOp("ROL", Absolute, 6, (*CPU).rol),
+	0x2f: unofficial(addressOp("RLA", Absolute, 6, (*CPU).rla)),
+	0x30: valueOp("BMI", Relative, 2, (*CPU).bmi),
+	0x31: valueOp("AND", IndirectY, 5, (*CPU).and),
+	0x32: unofficial(impliedOp("JAM", Implied, 2, (*CPU).jam)),
+	0x33: unofficial(addressOp("RLA", IndirectY, 8, (*CPU).rla)),
+	0x34: unofficial(valueOp("NOP", ZeroPageX, 4, (*CPU).nopRead)),
+	0x35: valueOp("AND", ZeroPageX, 4, (*CPU).and),
+	0x36: addressOp("ROL", ZeroPageX, 6, (*CPU).rol),
+	0x37: unofficial(addressOp("RLA", ZeroPageX, 6, (*CPU).rla)),
+	0x38: impliedOp("SEC", Implied, 2, (*CPU).sec),
+	0x39: valueOp("AND", AbsoluteY, 4, (*CPU).and),
+	0x3a: unofficial(impliedOp("NOP", Implied, 2, (*CPU).nop)),
+	0x3b: unofficial(addressOp("RLA", AbsoluteY, 7, (*CPU).rla)),
+	0x3c: unofficial(valueOp("NOP", AbsoluteX, 4, (*CPU).nopRead)),
+	0x3d: valueOp("AND", AbsoluteX, 4, (*CPU).and),
+	0x3e: addressOp("ROL", AbsoluteX, 7, (*CPU).rol),
+	0x3f: unofficial(addressOp("RLA", AbsoluteX, 7, (*CPU).rla)),
+	0x40: impliedOp("RTI", Implied, 6, (*CPU).rti),
+	0x41: valueOp("EOR", IndirectX, 6, (*CPU).eor),
+	0x42: unofficial(impliedOp("JAM", Implied, 2, (*CPU).jam)),
+	0x43: unofficial(addressOp("SRE", IndirectX, 8, (*CPU).sre)),
+	0x44: unofficial(valueOp("NOP", ZeroPage, 3, (*CPU).nopRead)),
+	0x45: valueOp("EOR", ZeroPage, 3, (*CPU).eor),
+	0x46: addressOp("LSR", ZeroPage, 5, (*CPU).lsr),
+	0x47: unofficial(addressOp("SRE", ZeroPage, 5, (*CPU).sre)),
+	0x48: impliedOp("PHA", Implied, 3, (*CPU).pha),
+	0x49: valueOp("EOR", Immediate, 2, (*CPU).eor),
+	0x4a: impliedOp("LSR", Accumulator, 2, (*CPU).lsr_acc),
+	0x4b: unofficial(valueOp("ALR", Immediate, 2, (*CPU).alr)),
+	0x4c: addressOp("JMP", Absolute, 3, (*CPU).jmp),
+	0x4d: valueOp("EOR", Absolute, 4, (*CPU).eor),
+	0x4e: addressOp("LSR", Absolute, 6, (*CPU).lsr),
+	0x4f: unofficial(addressOp("SRE", Absolute, 6, (*CPU).sre)),
+	0x50: valueOp("BVC", Relative, 2, (*CPU).bvc),
+	0x51: valueOp("EOR", IndirectY, 5, (*CPU).eor),
+	0x52: unofficial(impliedOp("JAM", Implied, 2, (*CPU).jam)),
+	0x53: unofficial(addressOp("SRE", IndirectY, 8, (*CPU).sre)),
+	0x54: unofficial(valueOp("NOP", ZeroPageX, 4, (*CPU).nopRead)),
+	0x55: valueOp("EOR", ZeroPageX, 4, (*CPU).eor),
+	0x56: addressOp("LSR", ZeroPageX, 6, (*CPU).lsr),
+	0x57: unofficial(addressOp("SRE", ZeroPageX, 6, (*CPU).sre)),
+	0x58: impliedOp("CLI", Implied, 2, (*CPU).cli),
+	0x59: valueOp("EOR", AbsoluteY, 4, (*CPU).eor),
+	0x5a: unofficial(impliedOp("NOP", Implied, 2, (*CPU).nop)),
+	0x5b: unofficial(addressOp("SRE", AbsoluteY, 7, (*CPU).sre)),
+	0x5c: unofficial(valueOp("NOP", AbsoluteX, 4, (*CPU).nopRead)),
+	0x5d: valueOp("EOR", AbsoluteX, 4, (*CPU).eor),
+	0x5e: addressOp("LSR", AbsoluteX, 7, (*CPU).lsr),
+	0x5f: unofficial(addressOp("SRE", AbsoluteX, 7, (*CPU).sre)),
+	0x60: impliedOp("RTS", Implied, 6, (*CPU).rts),
+	0x61: valueOp("ADC", IndirectX, 6, (*CPU).adc),
+	0x62: unofficial(impliedOp("JAM", Implied, 2, (*CPU).jam)),
+	0x63: unofficial(addressOp("RRA", IndirectX, 8, (*CPU).rra)),
+	0x64: unofficial(valueOp("NOP", ZeroPage, 3, (*CPU).nopRead)),
+	0x65: valueOp("ADC", ZeroPage, 3, (*CPU).adc),
+	0x66: addressOp("ROR", ZeroPage, 5, (*CPU).ror),
+	0x67: unofficial(addressOp("RRA", ZeroPage, 5, (*CPU).rra)),
+	0x68: impliedOp("PLA", Implied, 4, (*CPU).pla),
+	0x69: valueOp("ADC", Immediate, 2, (*CPU).adc),
+	0x6a: impliedOp("ROR", Accumulator, 2, (*CPU).ror_acc),
+	0x6b: unofficial(valueOp("ARR", Immediate, 2, (*CPU).arr)),
+	0x6c: addressOp("JMP", Indirect, 5, (*CPU).jmp),
+	0x6d: valueOp("ADC", Absolute, 4, (*CPU).adc),
+	0x6e: addressOp("ROR", Absolute, 6, (*CPU).ror),
+	0x6f: unofficial(addressOp("RRA", Absolute, 6, (*CPU).rra)),
+	0x70: valueOp("BVS", Relative, 2, (*CPU).bvs),
+	0x71: valueOp("ADC", IndirectY, 5, (*CPU).adc),
+	0x72: unofficial(impliedOp("JAM", Implied, 2, (*CPU).jam)),
+	0x73: unofficial(addressOp("RRA", IndirectY, 8, (*CPU).rra)),
+	0x74: unofficial(valueOp("NOP", ZeroPageX, 4, (*CPU).nopRead)),
+	0x75: valueOp("ADC", ZeroPageX, 4, (*CPU).adc),
+	0x76: addressOp("ROR", ZeroPageX, 6, (*CPU).ror),
+	0x77: unofficial(addressOp("RRA", ZeroPageX, 6, (*CPU).rra)),
+	0x78: impliedOp("SEI", Implied, 2, (*CPU).sei),
+	0x79: valueOp("ADC", AbsoluteY, 4, (*CPU).adc),
+	0x7a: unofficial(impliedOp("NOP", Implied, 2, (*CPU).nop)),
+	0x7b: unofficial(addressOp("RRA", AbsoluteY, 7, (*CPU).rra)),
+	0x7c: unofficial(valueOp("NOP", AbsoluteX, 4, (*CPU).nopRead)),
+	0x7d: valueOp("ADC", AbsoluteX, 4, (*CPU).adc),
+	0x7e: addressOp("ROR", AbsoluteX, 7, (*CPU).ror),
+	0x7f: unofficial(addressOp("RRA", AbsoluteX, 7, (*CPU).rra)),
+	0x80: unofficial(valueOp("NOP", Immediate, 2, (*CPU).nopRead)),
+	0x81: addressOp("STA", IndirectX, 6, (*CPU).sta),
+	0x82: unofficial(valueOp("NOP", Immediate, 2, (*CPU).nopRead)),
+	0x83: unofficial(addressOp("SAX", IndirectX, 6, (*CPU).sax)),
+	0x84: addressOp("STY", ZeroPage, 3, (*CPU).sty),
+	0x85: addressOp("STA", ZeroPage, 3, (*CPU).sta),
+	0x86: addressOp("STX", ZeroPage, 3, (*CPU).stx),
+	0x87: unofficial(addressOp("SAX", ZeroPage, 3, (*CPU).sax)),
+	0x88: impliedOp("DEY", Implied, 2, (*CPU).dey),
+	0x89: unofficial(valueOp("NOP", Immediate, 2, (*CPU).nopRead)),
+	0x8a: impliedOp("TXA", Implied, 2, (*CPU).txa),
+	0x8b: unofficial(valueOp("XAA", Immediate, 2, (*CPU).xaa)),
+	0x8c: addressOp("STY", Absolute, 4, (*CPU).sty),
+	0x8d: addressOp("STA", Absolute, 4, (*CPU).sta),
+	0x8e: addressOp("STX", Absolute, 4, (*CPU).stx),
+	0x8f: unofficial(addressOp("SAX", Absolute, 4, (*CPU).sax)),
+	0x90: valueOp("BCC", Relative, 2, (*CPU).bcc),
+	0x91: addressOp("STA", IndirectY, 6, (*CPU).sta),
+	0x92: unofficial(impliedOp("JAM", Implied, 2, (*CPU).jam)),
+	0x93: unofficial(addressOp("SHA", IndirectY, 6, (*CPU).sha)),
+	0x94: addressOp("STY", ZeroPageX, 4, (*CPU).sty),
+	0x95: addressOp("STA", ZeroPageX, 4, (*CPU).sta),
+	0x96: addressOp("STX", ZeroPageY, 4, (*CPU).stx),
+	0x97: unofficial(addressOp("SAX", ZeroPageY, 4, (*CPU).sax)),
+	0x98: impliedOp("TYA", Implied, 2, (*CPU).tya),
+	0x99: addressOp("STA", AbsoluteY, 5, (*CPU).sta),
+	0x9a: impliedOp("TXS", Implied, 2, (*CPU).txs),
+	0x9b: unofficial(addressOp("TAS", AbsoluteY, 5, (*CPU).tas)),
+	0x9c: unofficial(addressOp("SHY", AbsoluteX, 5, (*CPU).shy)),
+	0x9d: addressOp("STA", AbsoluteX, 5, (*CPU).sta),
+	0x9e: unofficial(addressOp("SHX", AbsoluteY, 5, (*CPU).shx)),
+	0x9f: unofficial(addressOp("SHA", AbsoluteY, 5, (*CPU).sha)),
+	0xa0: valueOp("LDY", Immediate, 2, (*CPU).ldy),
+	0xa1: valueOp("LDA", IndirectX, 6, (*CPU).lda),
+	0xa2: valueOp("LDX", Immediate, 2, (*CPU).ldx),
+	0xa3: unofficial(valueOp("LAX", IndirectX, 6, (*CPU).lax)),
+	0xa4: valueOp("LDY", ZeroPage, 3, (*CPU).ldy),
+	0xa5: valueOp("LDA", ZeroPage, 3, (*CPU).lda),
+	0xa6: valueOp("LDX", ZeroPage, 3, (*CPU).ldx),
+	0xa7: unofficial(valueOp("LAX", ZeroPage, 3, (*CPU).lax)),
+	0xa8: impliedOp("TAY", Implied, 2, (*CPU).tay),
+	0xa9: valueOp("LDA", Immediate, 2, (*CPU).lda),
+	0xaa: impliedOp("TAX", Implied, 2, (*CPU).tax),
+	0xab: unofficial(valueOp("LXA", Immediate, 2, (*CPU).lxa)),
+	0xac: valueOp("LDY", Absolute, 4, (*CPU).ldy),
+	0xad: valueOp("LDA", Absolute, 4, (*CPU).lda),
+	0xae: valueOp("LDX", Absolute, 4, (*CPU).ldx),
+	0xaf: unofficial(valueOp("LAX", Absolute, 4, (*CPU).lax)),
+	0xb0: valueOp("BCS", Relative, 2, (*CPU).bcs),
+	0xb1: valueOp("LDA", IndirectY, 5, (*CPU).lda),
+	0xb2: unofficial(impliedOp("JAM", Implied, 2, (*CPU).jam)),
+	0xb3: unofficial(valueOp("LAX", IndirectY, 5, (*CPU).lax)),
+	0xb4: valueOp("LDY", ZeroPageX, 4, (*CPU).ldy),
+	0xb5: valueOp("LDA", ZeroPageX, 4, (*CPU).lda),
+	0xb6: valueOp("LDX", ZeroPageY, 4, (*CPU).ldx),
+	0xb7: unofficial(valueOp("LAX", ZeroPageY, 4, (*CPU).lax)),
+	0xb8: impliedOp("CLV", Implied, 2, (*CPU).clv),
+	0xb9: valueOp("LDA", AbsoluteY, 4, (*CPU).lda),
+	0xba: impliedOp("TSX", Implied, 2, (*CPU).tsx),
+	0xbb: unofficial(valueOp("LAS", AbsoluteY, 4, (*CPU).las)),
+	0xbc: valueOp("LDY", AbsoluteX, 4, (*CPU).ldy),
+	0xbd: valueOp("LDA", AbsoluteX, 4, (*CPU).lda),
+	0xbe: valueOp("LDX", AbsoluteY, 4, (*CPU).ldx),
+	0xbf: unofficial(valueOp("LAX", AbsoluteY, 4, (*CPU).lax)),
+	0xc0: valueOp("CPY", Immediate, 2, (*CPU).cpy),
+	0xc1: valueOp("CMP", IndirectX, 6, (*CPU).cmp),
+	0xc2: unofficial(valueOp("NOP", Immediate, 2, (*CPU).nopRead)),
+	0xc3: unofficial(addressOp("DCP", IndirectX, 8, (*CPU).dcp)),
+	0xc4: valueOp("CPY", ZeroPage, 3, (*CPU).cpy),
+	0xc5: valueOp("CMP", ZeroPage, 3, (*CPU).cmp),
+	0xc6: addressOp("DEC", ZeroPage, 5, (*CPU).dec),
+	0xc7: unofficial(addressOp("DCP", ZeroPage, 5, (*CPU).dcp)),
+	0xc8: impliedOp("INY", Implied, 2, (*CPU).iny),
+	0xc9: valueOp("CMP", Immediate, 2, (*CPU).cmp),
+	0xca: impliedOp("DEX", Implied, 2, (*CPU).dex),
+	0xcb: unofficial(valueOp("AXS", Immediate, 2, (*CPU).axs)),
+	0xcc: valueOp("CPY", Absolute, 4, (*CPU).cpy),
+	0xcd: valueOp("CMP", Absolute, 4, (*CPU).cmp),
+	0xce: addressOp("DEC", Absolute, 6, (*CPU).dec),
+	0xcf: unofficial(addressOp("DCP", Absolute, 6, (*CPU).dcp)),
+	0xd0: valueOp("BNE", Relative, 2, (*CPU).bne),
+	0xd1: valueOp("CMP", IndirectY, 5, (*CPU).cmp),
+	0xd2: unofficial(impliedOp("JAM", Implied, 2, (*CPU).jam)),
+	0xd3: unofficial(addressOp("DCP", IndirectY, 8, (*CPU).dcp)),
+	0xd4: unofficial(valueOp("NOP", ZeroPageX, 4, (*CPU).nopRead)),
+	0xd5: valueOp("CMP", ZeroPageX, 4, (*CPU).cmp),
+	0xd6: addressOp("DEC", ZeroPageX, 6, (*CPU).dec),
+	0xd7: unofficial(addressOp("DCP", ZeroPageX, 6, (*CPU).dcp)),
+	0xd8: impliedOp("CLD", Implied, 2, (*CPU).cld),
+	0xd9: valueOp("CMP", AbsoluteY, 4, (*CPU).cmp),
+	0xda: unofficial(impliedOp("NOP", Implied, 2, (*CPU).nop)),
+	0xdb: unofficial(addressOp("DCP", AbsoluteY, 7, (*CPU).dcp)),
+	0xdc: unofficial(valueOp("NOP", AbsoluteX, 4, (*CPU).nopRead)),
+	0xdd: valueOp("CMP", AbsoluteX, 4, (*CPU).cmp),
+	0xde: addressOp("DEC", AbsoluteX, 7, (*CPU).dec),
+	0xdf: unofficial(addressOp("DCP", AbsoluteX, 7, (*CPU).dcp)),
+	0xe0: valueOp("CPX", Immediate, 2, (*CPU).cpx),
+	0xe1: valueOp("SBC", IndirectX, 6, (*CPU).sbc),
+	0xe2: unofficial(valueOp("NOP", Immediate, 2, (*CPU).nopRead)),
+	0xe3: unofficial(addressOp("ISB", IndirectX, 8, (*CPU).isb)),
+	0xe4: valueOp("CPX", ZeroPage, 3, (*CPU).cpx),
+	0xe5: valueOp("SBC", ZeroPage, 3, (*CPU).sbc),
+	0xe6: addressOp("INC", ZeroPage, 5, (*CPU).inc),
+	0xe7: unofficial(addressOp("ISB", ZeroPage, 5, (*CPU).isb)),
+	0xe8: impliedOp("INX", Implied, 2, (*CPU).inx),
+	0xe9: valueOp("SBC", Immediate, 2, (*CPU).sbc),
+	0xea: impliedOp("NOP", Implied, 2, (*CPU).nop),
+	0xeb: unofficial(valueOp("SBC", Immediate, 2, (*CPU).sbc)),
+	0xec: valueOp("CPX", Absolute, 4, (*CPU).cpx),
+	0xed: valueOp("SBC", Absolute, 4, (*CPU).sbc),
+	0xee: addressOp("INC", Absolute, 6, (*CPU).inc),
+	0xef: unofficial(addressOp("ISB", Absolute, 6, (*CPU).isb)),
+	0xf0: valueOp("BEQ", Relative, 2, (*CPU).beq),
+	0xf1: valueOp("SBC", IndirectY, 5, (*CPU).sbc),
+	0xf2: unofficial(impliedOp("JAM", Implied, 2, (*CPU).jam)),
+	0xf3: unofficial(addressOp("ISB", IndirectY, 8, (*CPU).isb)),
+	0xf4: unofficial(valueOp("NOP", ZeroPageX, 4, (*CPU).nopRead)),
+	0xf5: valueOp("SBC", ZeroPageX, 4, (*CPU).sbc),
+	0xf6: addressOp("INC", ZeroPageX, 6, (*CPU).inc),
+	0xf7: unofficial(addressOp("ISB", ZeroPageX, 6, (*CPU).isb)),
+	0xf8: impliedOp("SED", Implied, 2, (*CPU).sed),
+	0xf9: valueOp("SBC", AbsoluteY, 4, (*CPU).sbc),
+	0xfa: unofficial(impliedOp("NOP", Implied, 2, (*CPU).nop)),
+	0xfb: unofficial(addressOp("ISB", AbsoluteY, 7, (*CPU).isb)),
+	0xfc: unofficial(valueOp("NOP", AbsoluteX, 4, (*CPU).nopRead)),
+	0xfd: valueOp("SBC", AbsoluteX, 4, (*CPU).sbc),
+	0xfe: addressOp("INC", AbsoluteX, 7, (*CPU).inc),
+	0xff: unofficial(addressOp("ISB", AbsoluteX, 7, (*CPU).isb)),
+}
+
+func GetOpcode(opcode byte) Opcode {
+	return opcodeTable[opcode]
+}
+
+func (opcode Opcode) Format(operand, nextPc uint16) string {
+	mnemonic := opcode.Mnemonic
+	if opcode.Unofficial {
+		mnemonic = "*" + mnemonic
+	}
+
+	switch opcode.Mode {
+	case Accumulator:
+		return mnemonic + " A"
+	case Immediate:
+		return fmt.Sprintf("%v #$%02X", mnemonic, operand)
+	case ZeroPage:
+		return fmt.Sprintf("%v $%02X", mnemonic, operand)
+	case ZeroPageX:
+		return fmt.Sprintf("%v $%02X, X", mnemonic, operand)
+	case ZeroPageY:
+		return fmt.Sprintf("%v $%02X, Y", mnemonic, operand)
+	case Absolute:
+		return fmt.Sprintf("%v $%04X", mnemonic, operand)
+	case AbsoluteX:
+		return fmt.Sprintf("%v $%04X, X", mnemonic, operand)
+	case AbsoluteY:
+		return fmt.Sprintf("%v $%04X, Y", mnemonic, operand)
+	case Indirect:
+		return fmt.Sprintf("%v ($%04X)", mnemonic, operand)
+	case IndirectX:
+		return fmt.Sprintf("%v ($%02X, X)", mnemonic, operand)
+	case IndirectY:
+		return fmt.Sprintf("%v ($%02X), Y", mnemonic, operand)
+	case Relative:
+		// Branches show the destination instead of the displacement
+		return fmt.Sprintf("%v $%04X", mnemonic, nextPc+uint16(int8(operand)))
+	}
+
+	return mnemonic
+}
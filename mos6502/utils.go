@@ -15,3 +15,7 @@ func subOverflow(a, b byte) (byte, bool) {
 func isNegative(val byte) bool {
 	return (val & 0x80) == 0x80
 }
+
+func pagesDiffer(a, b uint16) bool {
+	return a&0xff00 != b&0xff00
+}
@@ -0,0 +1,274 @@
+package movie
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"nes-go/controller"
+	"nes-go/emulator"
+	"strconv"
+	"strings"
+)
+
+const (
+	FM2_VERSION = 3
+	// Buttons of a gamepad in an input log line, from bit 7 to bit 0
+	FM2_BUTTONS = "RLDUTSBA"
+	// Input device of port0 and port1
+	FM2_GAMEPAD = 1
+
+	CHECKSUM_PREFIX = "base64:"
+)
+
+// Commands issued at the start of a frame, before its input
+type Command int
+
+const (
+	COMMAND_RESET Command = 1 << iota
+	COMMAND_POWER
+	COMMAND_FDS_INSERT
+	COMMAND_FDS_SELECT
+	COMMAND_VS_COIN
+)
+
+type Frame struct {
+	Commands Command
+	Buttons  [controller.PORTS_COUNT]controller.Buttons
+}
+
+// Input recorded from power on, in the FM2 format of FCEUX.
+// See https://fceux.com/web/FM2.html
+type Movie struct {
+	EmuVersion    int
+	RerecordCount int
+	Pal           bool
+	RomFilename   string
+	// MD5 of PRG and CHR ROM
+	RomChecksum [md5.Size]byte
+	Guid        string
+	// Input devices of the two ports, FM2_GAMEPAD or 0 when empty
+	Ports    [controller.PORTS_COUNT]int
+	Comments []string
+	// Frame number and text, kept as is
+	Subtitles []string
+
+	Frames []Frame
+}
+
+// MD5 of the cartridge contents, like FCEUX computes it
+func RomChecksum(rom *emulator.Rom) [md5.Size]byte {
+	hash := md5.New()
+	hash.Write(rom.PrgData)
+	hash.Write(rom.ChrData)
+
+	var sum [md5.Size]byte
+	copy(sum[:], hash.Sum(nil))
+	return sum
+}
+
+func newGuid() string {
+	var id [16]byte
+	rand.Read(id[:])
+
+	return fmt.Sprintf("%X-%X-%X-%X-%X", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
+// Empty movie for a cartridge, with a gamepad in each port
+func New(rom *emulator.Rom, romFilename string) *Movie {
+	return &Movie{
+		RomFilename: romFilename,
+		RomChecksum: RomChecksum(rom),
+		Guid:        newGuid(),
+		Ports:       [controller.PORTS_COUNT]int{FM2_GAMEPAD, FM2_GAMEPAD},
+	}
+}
+
+func parseButtons(field string) (controller.Buttons, error) {
+	if field == "" {
+		return 0, nil
+	}
+	if len(field) != len(FM2_BUTTONS) {
+		return 0, fmt.Errorf("invalid gamepad input %q", field)
+	}
+
+	var buttons controller.Buttons
+	for i, char := range []byte(field) {
+		if char != '.' && char != ' ' {
+			buttons |= 1 << (len(FM2_BUTTONS) - 1 - i)
+		}
+	}
+
+	return buttons, nil
+}
+
+func formatButtons(buttons controller.Buttons) string {
+	field := []byte(FM2_BUTTONS)
+	for i := range field {
+		if buttons&(1<<(len(FM2_BUTTONS)-1-i)) == 0 {
+			field[i] = '.'
+		}
+	}
+
+	return string(field)
+}
+
+// Input log lines look like |commands|port0|port1|port2|
+func parseFrame(line string) (Frame, error) {
+	fields := strings.Split(line, "|")
+	if len(fields) < 5 {
+		return Frame{}, fmt.Errorf("invalid input log line %q", line)
+	}
+
+	var frame Frame
+	commands, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return Frame{}, fmt.Errorf("invalid commands in input log line %q", line)
+	}
+	frame.Commands = Command(commands)
+
+	for port := range frame.Buttons {
+		if frame.Buttons[port], err = parseButtons(fields[2+port]); err != nil {
+			return Frame{}, err
+		}
+	}
+
+	return frame, nil
+}
+
+func parseChecksum(value string) ([md5.Size]byte, error) {
+	var checksum [md5.Size]byte
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, CHECKSUM_PREFIX))
+	if err != nil || len(decoded) != md5.Size {
+		return checksum, fmt.Errorf("invalid rom checksum %q", value)
+	}
+
+	copy(checksum[:], decoded)
+	return checksum, nil
+}
+
+func parseHeader(movie *Movie, key, value string) error {
+	var err error
+
+	switch key {
+	case "version":
+		if value != strconv.Itoa(FM2_VERSION) {
+			return fmt.Errorf("unsupported FM2 version %v", value)
+		}
+	case "emuVersion":
+		movie.EmuVersion, err = strconv.Atoi(value)
+	case "rerecordCount":
+		movie.RerecordCount, err = strconv.Atoi(value)
+	case "palFlag":
+		movie.Pal = value == "1"
+	case "romFilename":
+		movie.RomFilename = value
+	case "romChecksum":
+		movie.RomChecksum, err = parseChecksum(value)
+	case "guid":
+		movie.Guid = value
+	case "port0":
+		movie.Ports[0], err = strconv.Atoi(value)
+	case "port1":
+		movie.Ports[1], err = strconv.Atoi(value)
+	case "comment":
+		movie.Comments = append(movie.Comments, value)
+	case "subtitle":
+		movie.Subtitles = append(movie.Subtitles, value)
+	case "fourscore":
+		if value == "1" {
+			return fmt.Errorf("four score movies aren't supported")
+		}
+	case "binary":
+		if value == "1" {
+			return fmt.Errorf("binary input logs aren't supported")
+		}
+	case "savestate":
+		return fmt.Errorf("movies starting from a save state aren't supported")
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %v %q: %w", key, value, err)
+	}
+
+	return nil
+}
+
+func Read(r io.Reader) (*Movie, error) {
+	movie := &Movie{}
+	scanner := bufio.NewScanner(r)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "|"):
+			frame, err := parseFrame(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %w", lineNumber, err)
+			}
+			movie.Frames = append(movie.Frames, frame)
+		default:
+			key, value, _ := strings.Cut(line, " ")
+			if err := parseHeader(movie, key, value); err != nil {
+				return nil, fmt.Errorf("line %v: %w", lineNumber, err)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return movie, nil
+}
+
+func boolFlag(value bool) int {
+	if value {
+		return 1
+	}
+
+	return 0
+}
+
+func (movie *Movie) Write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintf(out, "version %v\n", FM2_VERSION)
+	fmt.Fprintf(out, "emuVersion %v\n", movie.EmuVersion)
+	fmt.Fprintf(out, "rerecordCount %v\n", movie.RerecordCount)
+	fmt.Fprintf(out, "palFlag %v\n", boolFlag(movie.Pal))
+	fmt.Fprintf(out, "romFilename %v\n", movie.RomFilename)
+	fmt.Fprintf(out, "romChecksum %v%v\n", CHECKSUM_PREFIX, base64.StdEncoding.EncodeToString(movie.RomChecksum[:]))
+	fmt.Fprintf(out, "guid %v\n", movie.Guid)
+	fmt.Fprintf(out, "fourscore 0\n")
+	fmt.Fprintf(out, "microphone 0\n")
+	fmt.Fprintf(out, "port0 %v\n", movie.Ports[0])
+	fmt.Fprintf(out, "port1 %v\n", movie.Ports[1])
+	fmt.Fprintf(out, "port2 0\n")
+	fmt.Fprintf(out, "FDS 0\n")
+	fmt.Fprintf(out, "NewPPU 0\n")
+	for _, comment := range movie.Comments {
+		fmt.Fprintf(out, "comment %v\n", comment)
+	}
+	for _, subtitle := range movie.Subtitles {
+		fmt.Fprintf(out, "subtitle %v\n", subtitle)
+	}
+
+	for _, frame := range movie.Frames {
+		fmt.Fprintf(out, "|%v|", frame.Commands)
+		for port, buttons := range frame.Buttons {
+			if movie.Ports[port] == FM2_GAMEPAD {
+				out.WriteString(formatButtons(buttons))
+			}
+			out.WriteString("|")
+		}
+		out.WriteString("|\n")
+	}
+
+	return out.Flush()
+}
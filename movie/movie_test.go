@@ -0,0 +1,177 @@
+package movie
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"nes-go/console"
+	"nes-go/controller"
+	"nes-go/emulator"
+	"strings"
+	"testing"
+)
+
+const (
+	// Buttons of the first controller read in the last NMI, A in bit 7
+	BUTTONS_READ = 0x10
+	NMI_COUNTER  = 0x11
+)
+
+// Reads the first controller on every vblank NMI
+func newTestConsole(t *testing.T) *console.Console {
+	header := []byte{'N', 'E', 'S', 0x1a, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	prg := make([]byte, emulator.PRG_BYTES_UNITS*emulator.BYTES_IN_KILOBYTES)
+	copy(prg, []byte{
+		0xa9, 0x80, // LDA #$80
+		0x8d, 0x00, 0x20, // STA $2000
+		0x4c, 0x05, 0x80, // JMP $8005
+	})
+	copy(prg[0x10:], []byte{
+		0xa9, 0x01, // LDA #$01
+		0x8d, 0x16, 0x40, // STA $4016
+		0xa9, 0x00, // LDA #$00
+		0x8d, 0x16, 0x40, // STA $4016
+		0xa2, 0x08, // LDX #$08
+		0xad, 0x16, 0x40, // LDA $4016
+		0x4a,               // LSR A
+		0x26, BUTTONS_READ, // ROL $10
+		0xca,       // DEX
+		0xd0, 0xf7, // BNE $801C
+		0xe6, NMI_COUNTER, // INC $11
+		0x40, // RTI
+	})
+	copy(prg[0x3ffa:], []byte{0x10, 0x80, 0x00, 0x80, 0x00, 0x80})
+
+	nes, err := console.New(append(header, prg...))
+	assert.Nil(t, err)
+
+	return nes
+}
+
+const TEST_MOVIE = `version 3
+emuVersion 22020
+rerecordCount 4
+palFlag 0
+romFilename test
+romChecksum base64:AAECAwQFBgcICQoLDA0ODw==
+guid 4A2F3C1D-0000-4000-8000-0123456789AB
+fourscore 0
+microphone 0
+port0 1
+port1 1
+port2 0
+FDS 0
+NewPPU 0
+comment author someone
+|0|........|........||
+|1|R......A|...U....||
+|2|..D..S.A|.L..T.B.||
+`
+
+func TestReadMovie(t *testing.T) {
+	movie, err := Read(strings.NewReader(TEST_MOVIE))
+	assert.Nil(t, err)
+
+	assert.Equal(t, 22020, movie.EmuVersion)
+	assert.Equal(t, 4, movie.RerecordCount)
+	assert.Equal(t, "test", movie.RomFilename)
+	assert.Equal(t, [16]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, movie.RomChecksum)
+	assert.Equal(t, []string{"author someone"}, movie.Comments)
+
+	assert.Equal(t, []Frame{
+		{},
+		{COMMAND_RESET, [2]controller.Buttons{controller.BUTTON_RIGHT | controller.BUTTON_A, controller.BUTTON_UP}},
+		{COMMAND_POWER, [2]controller.Buttons{
+			controller.BUTTON_DOWN | controller.BUTTON_SELECT | controller.BUTTON_A,
+			controller.BUTTON_LEFT | controller.BUTTON_START | controller.BUTTON_B,
+		}},
+	}, movie.Frames)
+
+	// Written back the same
+	var written bytes.Buffer
+	assert.Nil(t, movie.Write(&written))
+	assert.Equal(t, TEST_MOVIE, written.String())
+}
+
+func TestReadInvalidMovie(t *testing.T) {
+	for _, text := range []string{
+		"version 2\n",
+		"fourscore 1\n",
+		"romChecksum base64:AAEC\n",
+		"|0|.......|........||\n",
+		"|x|........|........||\n",
+	} {
+		_, err := Read(strings.NewReader(text))
+		assert.NotNil(t, err, text)
+	}
+}
+
+func TestRecordAndPlay(t *testing.T) {
+	nes := newTestConsole(t)
+	recorder, err := NewRecorder(nes, "test")
+	assert.Nil(t, err)
+
+	assert.Nil(t, recorder.StepFrame(Frame{}))
+	assert.Nil(t, recorder.StepFrame(Frame{Buttons: [2]controller.Buttons{controller.BUTTON_A}}))
+	assert.Equal(t, byte(0x80), nes.Mem.CPUData[BUTTONS_READ])
+	assert.Nil(t, recorder.StepFrame(Frame{}))
+	assert.Nil(t, recorder.StepFrame(Frame{Buttons: [2]controller.Buttons{controller.BUTTON_RIGHT}}))
+	assert.Nil(t, recorder.StepFrame(Frame{Commands: COMMAND_POWER}))
+	for range 3 {
+		assert.Nil(t, recorder.StepFrame(Frame{Buttons: [2]controller.Buttons{controller.BUTTON_B}}))
+	}
+	ram := nes.Mem.CPUData
+
+	var file bytes.Buffer
+	assert.Nil(t, recorder.Movie().Write(&file))
+	movie, err := Read(&file)
+	assert.Nil(t, err)
+	assert.Equal(t, recorder.Movie().Frames, movie.Frames)
+
+	other := newTestConsole(t)
+	player, err := NewPlayer(other, movie)
+	assert.Nil(t, err)
+
+	for {
+		more, err := player.StepFrame()
+		assert.Nil(t, err)
+		if !more {
+			break
+		}
+	}
+	assert.True(t, player.Done())
+	assert.Equal(t, 8, player.Frame())
+	assert.Equal(t, ram, other.Mem.CPUData)
+	assert.Equal(t, byte(0x40), other.Mem.CPUData[BUTTONS_READ])
+}
+
+func TestPlayDifferentRom(t *testing.T) {
+	movie, err := Read(strings.NewReader(TEST_MOVIE))
+	assert.Nil(t, err)
+
+	_, err = NewPlayer(newTestConsole(t), movie)
+	assert.NotNil(t, err)
+}
+
+func TestMoviePorts(t *testing.T) {
+	nes := newTestConsole(t)
+	movie := New(nes.Rom, "test")
+	pressed := Frame{Buttons: [2]controller.Buttons{controller.BUTTON_A}}
+	movie.Frames = []Frame{pressed, pressed}
+
+	// Nothing plugged into the first port
+	movie.Ports[0] = 0
+	player, err := NewPlayer(nes, movie)
+	assert.Nil(t, err)
+	for !player.Done() {
+		_, err = player.StepFrame()
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, byte(1), nes.Mem.CPUData[NMI_COUNTER])
+	assert.Equal(t, byte(0), nes.Mem.CPUData[BUTTONS_READ])
+
+	// A zapper
+	movie.Ports[1] = 2
+	_, err = NewPlayer(nes, movie)
+	assert.ErrorContains(t, err, "port1")
+}
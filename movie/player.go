@@ -0,0 +1,102 @@
+package movie
+
+import (
+	"fmt"
+	"nes-go/console"
+	"nes-go/controller"
+)
+
+// Applies the commands and buttons of a frame, then runs it. Ports without
+// a gamepad are left alone
+func runFrame(nes *console.Console, ports [controller.PORTS_COUNT]int, frame Frame) error {
+	if frame.Commands&COMMAND_POWER != 0 {
+		if err := nes.PowerCycle(); err != nil {
+			return err
+		}
+	}
+	if frame.Commands&COMMAND_RESET != 0 {
+		nes.Reset()
+	}
+
+	for port, buttons := range frame.Buttons {
+		if ports[port] == FM2_GAMEPAD {
+			nes.SetButtons(port, buttons)
+		}
+	}
+	nes.StepFrame()
+
+	return nil
+}
+
+// Plays back a movie on a console just powered on
+type Player struct {
+	nes   *console.Console
+	movie *Movie
+	frame int
+}
+
+// Fails when the movie was recorded with a different cartridge, or with
+// input devices other than gamepads
+func NewPlayer(nes *console.Console, movie *Movie) (*Player, error) {
+	if movie.RomChecksum != RomChecksum(nes.Rom) {
+		return nil, fmt.Errorf("movie recorded with a different rom: %v", movie.RomFilename)
+	}
+
+	for port, device := range movie.Ports {
+		if device != 0 && device != FM2_GAMEPAD {
+			return nil, fmt.Errorf("unsupported input device %v in port%v", device, port)
+		}
+	}
+
+	return &Player{nes: nes, movie: movie}, nil
+}
+
+// Runs the next frame of the movie, false once all of them were played
+func (player *Player) StepFrame() (bool, error) {
+	if player.Done() {
+		return false, nil
+	}
+
+	frame := player.movie.Frames[player.frame]
+	player.frame++
+
+	return true, runFrame(player.nes, player.movie.Ports, frame)
+}
+
+func (player *Player) Done() bool {
+	return player.frame == len(player.movie.Frames)
+}
+
+func (player *Player) Movie() *Movie {
+	return player.movie
+}
+
+// Frames played so far
+func (player *Player) Frame() int {
+	return player.frame
+}
+
+// Records the input of every frame run through it, from power on
+type Recorder struct {
+	nes   *console.Console
+	movie *Movie
+}
+
+// Power cycles the console, so the movie can be played back from the start
+func NewRecorder(nes *console.Console, romFilename string) (*Recorder, error) {
+	if err := nes.PowerCycle(); err != nil {
+		return nil, err
+	}
+
+	return &Recorder{nes: nes, movie: New(nes.Rom, romFilename)}, nil
+}
+
+func (recorder *Recorder) StepFrame(frame Frame) error {
+	recorder.movie.Frames = append(recorder.movie.Frames, frame)
+
+	return runFrame(recorder.nes, recorder.movie.Ports, frame)
+}
+
+func (recorder *Recorder) Movie() *Movie {
+	return recorder.movie
+}
@@ -0,0 +1,139 @@
+package ppu
+
+import (
+	"nes-go/emulator"
+)
+
+const (
+	SCREEN_WIDTH  = 256
+	SCREEN_HEIGHT = 240
+
+	TILES_PER_ROW    = 32
+	TILES_PER_COLUMN = 30
+	ATTRIBUTE_TABLE  = 0x03c0
+	PALETTE_ENTRIES  = 4
+)
+
+// Increments the coarse X of a loopy register, switching to the
+// horizontally adjacent nametable when it wraps
+func incrementX(v uint16) uint16 {
+	if v&LOOPY_COARSE_X == LOOPY_COARSE_X {
+		return (v &^ LOOPY_COARSE_X) ^ 0x0400
+	}
+
+	return v + 1
+}
+
+// Increments the fine Y of v, moving to the next row of tiles when it wraps.
+// Row 29 is the last one of a nametable, rows 30 and 31 hold the attributes
+// and wrap without switching nametables
+func (ppu *PPU) incrementY() {
+	if ppu.v&LOOPY_FINE_Y != LOOPY_FINE_Y {
+		ppu.v += 0x1000
+		return
+	}
+
+	ppu.v &^= LOOPY_FINE_Y
+	coarseY := (ppu.v & LOOPY_COARSE_Y) >> 5
+
+	switch coarseY {
+	case TILES_PER_COLUMN - 1:
+		coarseY = 0
+		ppu.v ^= 0x0800
+	case TILES_PER_ROW - 1:
+		coarseY = 0
+	default:
+		coarseY++
+	}
+
+	ppu.v = ppu.v&^LOOPY_COARSE_Y | coarseY<<5
+}
+
+func (ppu *PPU) copyX() {
+	mask := LOOPY_COARSE_X | 0x0400
+	ppu.v = ppu.v&^mask | ppu.t&mask
+}
+
+func (ppu *PPU) copyY() {
+	mask := LOOPY_FINE_Y | LOOPY_COARSE_Y | 0x0800
+	ppu.v = ppu.v&^mask | ppu.t&mask
+}
+
+func (ppu *PPU) renderingEnabled() bool {
+	return ppu.mask&(MASK_BACKGROUND|MASK_SPRITES) != 0
+}
+
+func (ppu *PPU) backgroundTable() uint16 {
+	if ppu.ctrl&CTRL_BACKGROUND_TABLE != 0 {
+		return PATTERN_TABLE_1_ADDRESS
+	}
+
+	return PATTERN_TABLE_0_ADDRESS
+}
+
+// Pattern fetch of the tile at v without drawing it. The background is
+// fetched on the pre-render line and while only the sprites are shown too,
+// and mappers watching the PPU bus like MMC3 count on it
+func (ppu *PPU) fetchBackgroundTile() {
+	tileIdx, _ := ppu.mem.ReadPpu(emulator.NAMETABLES_START | ppu.v&0x0fff)
+	ppu.mem.ReadPpu(ppu.backgroundTable() + uint16(tileIdx)*TILE_SIZE_IN_BYTES*2)
+}
+
+// Fills the background of a scanline walking the nametables from v,
+// leaving the palette indexes of each pixel in bgPixels
+func (ppu *PPU) renderBackground() {
+	clear(ppu.bgPixels[:])
+	if ppu.mask&MASK_BACKGROUND == 0 {
+		if ppu.renderingEnabled() {
+			ppu.fetchBackgroundTile()
+		}
+		return
+	}
+
+	v := ppu.v
+	fineY := (v & LOOPY_FINE_Y) >> 12
+	table := ppu.backgroundTable()
+
+	// 33 tiles, the first one is partially hidden by the fine X scroll
+	for tile := range TILES_PER_ROW + 1 {
+		nametable := emulator.NAMETABLES_START | v&0x0fff
+		tileIdx, _ := ppu.mem.ReadPpu(nametable)
+
+		attrAddress := emulator.NAMETABLES_START | ATTRIBUTE_TABLE | v&0x0c00 | (v>>4)&0x38 | (v>>2)&0x07
+		attr, _ := ppu.mem.ReadPpu(attrAddress)
+		shift := (v>>4)&0x04 | v&0x02
+		palette := (attr >> shift) & 0x03
+
+		patternAddress := table + uint16(tileIdx)*TILE_SIZE_IN_BYTES*2 + fineY
+		plane0, _ := ppu.mem.ReadPpu(patternAddress)
+		plane1, _ := ppu.mem.ReadPpu(patternAddress + TILE_SIZE_IN_BYTES)
+
+		for col := range TILE_SIZE_IN_BYTES {
+			x := tile*TILE_SIZE_IN_BYTES + col - int(ppu.x)
+			if x < 0 || x >= SCREEN_WIDTH {
+				continue
+			}
+
+			bit := 7 - col
+			pixel := (plane0>>bit)&1 | ((plane1>>bit)&1)<<1
+			if pixel == 0 || (x < TILE_SIZE_IN_BYTES && ppu.mask&MASK_BACKGROUND_LEFT == 0) {
+				continue
+			}
+
+			ppu.bgPixels[x] = palette*PALETTE_ENTRIES + pixel
+		}
+
+		v = incrementX(v)
+	}
+}
+
+// Draws a visible scanline into the frame buffer, with the sprites fetched
+// during the previous one
+func (ppu *PPU) renderScanline(line int) {
+	ppu.renderBackground()
+
+	for x := range SCREEN_WIDTH {
+		// Transparent pixels show the backdrop color at $3F00
+		ppu.frame.SetRGBA(x, line, ppu.paletteColor(ppu.composePixel(x)))
+	}
+}
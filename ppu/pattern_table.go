@@ -87,11 +87,22 @@ func GenerateImage(path string, table PatternTable) {
 		}
 	}
 
+	if err := WritePng(path, img); err != nil {
+		fmt.Printf("Error creating path %v: %v", path, err)
+	}
+}
+
+// Saves an image, like a pattern table or a frame, as a PNG file
+func WritePng(path string, img image.Image) error {
 	f, err := os.Create(path)
 	if err != nil {
-		fmt.Printf("Error creating path %v: %v", path, err)
-		return
+		return err
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		return err
 	}
 
-	png.Encode(f, img)
+	return f.Close()
 }
@@ -1,25 +1,28 @@
 package ppu
 
 import (
+	"image"
+	"io"
 	"nes-go/emulator"
 )
 
 /*
 * Registers: from $2000 to $2007 and repeated from $2008 to $3FFF.
 * A write in $3456 is the same as a write in $2006.
-*/
+ */
 const (
-	PPUCTRL uint16 = 0x2000
-	PPUMASK   = 0x2001
-	PPUSTATUS = 0x2002
-	OAMADDR   = 0x2003
-	OAMDATA   = 0x2004
-	PPUSCROLL = 0x2005
-	PPUADDR   = 0x2006
-	PPUDATA   = 0x2007
-	OAMDMA    = 0x4014
-)
+	PPUCTRL   uint16 = 0x2000
+	PPUMASK          = 0x2001
+	PPUSTATUS        = 0x2002
+	OAMADDR          = 0x2003
+	OAMDATA          = 0x2004
+	PPUSCROLL        = 0x2005
+	PPUADDR          = 0x2006
+	PPUDATA          = 0x2007
+	OAMDMA           = 0x4014
 
+	OAM_SIZE = 0x100
+)
 
 type PPU struct {
 	/*
@@ -39,25 +42,121 @@ type PPU struct {
 	 *	$3F20-$3FFF 	$00E0 	Mirrors of $3F00-$3F1F
 	 */
 	mem *emulator.Memory
+
+	ctrl    byte
+	mask    byte
+	status  byte
+	oamAddr byte
+	oam     [OAM_SIZE]byte
+
+	// Current VRAM address
+	v uint16
+	// Temporary VRAM address, the top left onscreen tile
+	t uint16
+	// Fine X scroll
+	x byte
+	// Write toggle shared by PPUSCROLL and PPUADDR
+	w bool
+
+	readBuffer byte
+	// Last value written to or read from a register
+	latch byte
+
+	frame *image.RGBA
+	// Palette RAM indexes of the background of the current scanline
+	bgPixels [SCREEN_WIDTH]byte
+	// Sprites of the current scanline, evaluated on the previous one
+	spritePixels    [SCREEN_WIDTH]spritePixel
+	lineSprites     [SPRITES_PER_LINE]byte
+	lineSpriteCount int
+	// Dot of the current scanline where sprite 0 hits the background, if any
+	sprite0HitDot int
+
+	scanline int
+	dot      int
+	// Dots since power up
+	cycles         uint64
+	frameCount     uint64
+	oddFrame       bool
+	suppressVblank bool
 }
 
 func NewPPU(memory *emulator.Memory) *PPU {
-	return &PPU{
-		mem: memory,
+	ppu := &PPU{
+		mem:   memory,
+		frame: image.NewRGBA(image.Rect(0, 0, SCREEN_WIDTH, SCREEN_HEIGHT)),
+		// Start on the pre-render scanline, so the first frame is complete
+		scanline: PRE_RENDER_SCANLINE,
 	}
+
+	// The PPU register range is always available, so this can't fail
+	memory.AttachDevice(PPUCTRL, PPUDATA, ppu)
+	memory.AttachWriteDevice(OAMDMA, OAMDMA, ppu)
+
+	return ppu
+}
+
+// The reset line clears the registers, but not the memories
+func (ppu *PPU) Reset() {
+	ppu.ctrl = 0
+	ppu.mask = 0
+	ppu.t = 0
+	ppu.x = 0
+	ppu.w = false
+	ppu.readBuffer = 0
+	ppu.oddFrame = false
+}
+
+// Last rendered frame, 256x240 pixels
+func (ppu *PPU) Frame() *image.RGBA {
+	return ppu.frame
+}
+
+func (ppu *PPU) getChrData() []byte {
+	data := make([]byte, emulator.CHR_DATA_SIZE)
+	for i := range data {
+		data[i], _ = ppu.mem.ReadPpu(uint16(i))
+	}
+
+	return data
 }
 
 func (ppu *PPU) GetPatternTable0() PatternTable {
-	data := ppu.mem.RomData.ChrData
+	data := ppu.getChrData()
 	return createPatternTable(data, PATTERN_TABLE_0_ADDRESS)
 }
 
 func (ppu *PPU) GetPatternTable1() PatternTable {
-	data := ppu.mem.RomData.ChrData
+	data := ppu.getChrData()
 	return createPatternTable(data, PATTERN_TABLE_1_ADDRESS)
 }
 
 func (ppu *PPU) GetPPUCTRLReg() byte {
-	val, _ := ppu.mem.ReadCpu(PPUCTRL)
-	return val
+	return ppu.ctrl
+}
+
+// Registers, OAM, the frame being drawn and the position of the beam.
+// VRAM and palette RAM are saved with the memory
+func (ppu *PPU) stateFields() []any {
+	fields := []any{
+		&ppu.ctrl, &ppu.mask, &ppu.status, &ppu.oamAddr, ppu.oam[:],
+		&ppu.v, &ppu.t, &ppu.x, &ppu.w, &ppu.readBuffer, &ppu.latch,
+		ppu.frame.Pix, ppu.bgPixels[:], ppu.lineSprites[:], &ppu.lineSpriteCount, &ppu.sprite0HitDot,
+		&ppu.scanline, &ppu.dot, &ppu.cycles, &ppu.frameCount, &ppu.oddFrame, &ppu.suppressVblank,
+	}
+
+	for i := range ppu.spritePixels {
+		pixel := &ppu.spritePixels[i]
+		fields = append(fields, &pixel.color, &pixel.behind, &pixel.zero)
+	}
+
+	return fields
+}
+
+func (ppu *PPU) SaveState(w io.Writer) error {
+	return emulator.WriteState(w, ppu.stateFields()...)
+}
+
+func (ppu *PPU) LoadState(r io.Reader) error {
+	return emulator.ReadState(r, ppu.stateFields()...)
 }
@@ -3,6 +3,7 @@ package ppu
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"nes-go/emulator"
 	"testing"
 )
 
@@ -25,3 +26,456 @@ func TestGetTile(t *testing.T) {
 	}
 	assert.Equal(t, expected, tile)
 }
+
+func newTestPPU(t *testing.T) (*PPU, *emulator.Memory) {
+	cartridge := make([]byte, emulator.HEADER_SIZE+emulator.PRG_BYTES_UNITS*emulator.BYTES_IN_KILOBYTES)
+	copy(cartridge, emulator.INES_MAGIC)
+	cartridge[4] = 1
+
+	rom, err := emulator.NewRom(cartridge)
+	assert.Nil(t, err)
+	mem, err := emulator.NewMemory(rom)
+	assert.Nil(t, err)
+
+	return NewPPU(mem), mem
+}
+
+func TestPpuScroll(t *testing.T) {
+	ppu, mem := newTestPPU(t)
+
+	mem.WriteCpu(0x02, PPUCTRL)
+	assert.Equal(t, uint16(0x0800), ppu.t)
+
+	mem.WriteCpu(0x7d, PPUSCROLL)
+	assert.Equal(t, uint16(0x080f), ppu.t)
+	assert.Equal(t, byte(0x05), ppu.x)
+	assert.True(t, ppu.w)
+
+	mem.WriteCpu(0x5e, PPUSCROLL)
+	assert.Equal(t, uint16(0x696f), ppu.t)
+	assert.False(t, ppu.w)
+
+	// Mirrors of the registers behave the same
+	mem.WriteCpu(0x3d, PPUADDR+0x1000)
+	assert.Equal(t, uint16(0x3d6f), ppu.t)
+	mem.WriteCpu(0xf0, PPUADDR)
+	assert.Equal(t, uint16(0x3df0), ppu.t)
+	assert.Equal(t, ppu.t, ppu.v)
+}
+
+func TestPpuStatus(t *testing.T) {
+	ppu, mem := newTestPPU(t)
+	ppu.status = STATUS_VBLANK | STATUS_SPRITE_0_HIT
+	mem.WriteCpu(0x12, PPUADDR)
+	assert.True(t, ppu.w)
+
+	// The lower bits come from the last value seen by the PPU
+	val, _ := mem.ReadCpu(PPUSTATUS)
+	assert.Equal(t, byte(0xd2), val)
+	assert.False(t, ppu.w)
+
+	val, _ = mem.ReadCpu(PPUSTATUS)
+	assert.Equal(t, byte(0x52), val)
+}
+
+func TestPpuData(t *testing.T) {
+	ppu, mem := newTestPPU(t)
+	mem.WriteCpu(0x21, PPUADDR)
+	mem.WriteCpu(0x08, PPUADDR)
+	mem.WriteCpu(0x11, PPUDATA)
+	mem.WriteCpu(0x22, PPUDATA)
+	assert.Equal(t, uint16(0x210a), ppu.v)
+
+	mem.WriteCpu(0x21, PPUADDR)
+	mem.WriteCpu(0x08, PPUADDR)
+
+	// Reads are delayed through the buffer
+	val, _ := mem.ReadCpu(PPUDATA)
+	assert.Equal(t, byte(0x00), val)
+	val, _ = mem.ReadCpu(PPUDATA)
+	assert.Equal(t, byte(0x11), val)
+	val, _ = mem.ReadCpu(PPUDATA)
+	assert.Equal(t, byte(0x22), val)
+
+	// Incrementing by 32 goes down a row of tiles
+	mem.WriteCpu(CTRL_INCREMENT, PPUCTRL)
+	mem.WriteCpu(0x20, PPUADDR)
+	mem.WriteCpu(0x00, PPUADDR)
+	mem.WriteCpu(0x33, PPUDATA)
+	assert.Equal(t, uint16(0x2020), ppu.v)
+
+	// Palette reads are direct, the buffer gets the nametable below
+	mem.WriteCpu(0x2f, PPUADDR)
+	mem.WriteCpu(0x00, PPUADDR)
+	mem.WriteCpu(0x44, PPUDATA)
+	mem.WriteCpu(0x3f, PPUADDR)
+	mem.WriteCpu(0x00, PPUADDR)
+	mem.WriteCpu(0x0c, PPUDATA)
+
+	mem.WriteCpu(0x3f, PPUADDR)
+	mem.WriteCpu(0x00, PPUADDR)
+	val, _ = mem.ReadCpu(PPUDATA)
+	assert.Equal(t, byte(0x0c), val)
+	assert.Equal(t, byte(0x44), ppu.readBuffer)
+}
+
+func TestOamData(t *testing.T) {
+	ppu, mem := newTestPPU(t)
+	mem.WriteCpu(0xfe, OAMADDR)
+	mem.WriteCpu(0x11, OAMDATA)
+	mem.WriteCpu(0x22, OAMDATA)
+	assert.Equal(t, byte(0x00), ppu.oamAddr)
+	assert.Equal(t, byte(0x22), ppu.oam[0xff])
+
+	// Reads don't increment the address
+	mem.WriteCpu(0xfe, OAMADDR)
+	val, _ := mem.ReadCpu(OAMDATA)
+	assert.Equal(t, byte(0x11), val)
+	val, _ = mem.ReadCpu(OAMDATA)
+	assert.Equal(t, byte(0x11), val)
+}
+
+func writePpuAddress(mem *emulator.Memory, address uint16) {
+	mem.WriteCpu(byte(address>>8), PPUADDR)
+	mem.WriteCpu(byte(address), PPUADDR)
+}
+
+func TestRenderBackground(t *testing.T) {
+	ppu, mem := newTestPPU(t)
+
+	// Tile 1 is solid color 1
+	for i := range uint16(TILE_SIZE_IN_BYTES) {
+		mem.WritePpu(0xff, 0x0010+i)
+	}
+	mem.WritePpu(0x01, 0x2000)
+	mem.WritePpu(0x0f, 0x3f00)
+	mem.WritePpu(0x30, 0x3f01)
+	mem.WritePpu(0x16, 0x3f05)
+
+	mem.WriteCpu(MASK_BACKGROUND|MASK_BACKGROUND_LEFT, PPUMASK)
+	writePpuAddress(mem, 0x0000)
+	ppu.RenderFrame()
+
+	frame := ppu.Frame()
+	assert.Equal(t, SYSTEM_PALETTE[0x30], frame.RGBAAt(0, 0))
+	assert.Equal(t, SYSTEM_PALETTE[0x30], frame.RGBAAt(7, 7))
+	assert.Equal(t, SYSTEM_PALETTE[0x0f], frame.RGBAAt(8, 0))
+	assert.Equal(t, SYSTEM_PALETTE[0x0f], frame.RGBAAt(0, 8))
+
+	// The attribute table selects the palette of each 16x16 area
+	mem.WritePpu(0x01, 0x23c0)
+	writePpuAddress(mem, 0x0000)
+	ppu.RenderFrame()
+	assert.Equal(t, SYSTEM_PALETTE[0x16], frame.RGBAAt(0, 0))
+
+	// Fine X scroll moves the tile to the left
+	mem.WriteCpu(0x04, PPUSCROLL)
+	mem.WriteCpu(0x00, PPUSCROLL)
+	ppu.RenderFrame()
+	assert.Equal(t, SYSTEM_PALETTE[0x16], frame.RGBAAt(3, 0))
+	assert.Equal(t, SYSTEM_PALETTE[0x0f], frame.RGBAAt(4, 0))
+
+	// The leftmost 8 pixels can be hidden
+	mem.WriteCpu(MASK_BACKGROUND, PPUMASK)
+	ppu.RenderFrame()
+	assert.Equal(t, SYSTEM_PALETTE[0x0f], frame.RGBAAt(3, 0))
+}
+
+func TestIncrementY(t *testing.T) {
+	ppu, _ := newTestPPU(t)
+
+	// Fine Y 7 of the last row switches to the nametable below
+	ppu.v = 0x73a0
+	ppu.incrementY()
+	assert.Equal(t, uint16(0x0800), ppu.v)
+
+	// Rows 30 and 31 wrap without switching
+	ppu.v = 0x73e0
+	ppu.incrementY()
+	assert.Equal(t, uint16(0x0000), ppu.v)
+
+	ppu.v = 0x0020
+	ppu.incrementY()
+	assert.Equal(t, uint16(0x1020), ppu.v)
+
+	assert.Equal(t, uint16(0x0400), incrementX(0x001f))
+}
+
+func setSprite(ppu *PPU, n int, y, tile, attributes, x byte) {
+	copy(ppu.oam[n*SPRITE_SIZE:], []byte{y, tile, attributes, x})
+}
+
+func newSpritesPPU(t *testing.T) (*PPU, *emulator.Memory) {
+	ppu, mem := newTestPPU(t)
+
+	// Tile 1 is solid color 1, tile 2 has only its top left pixel set
+	// and tile 3 is solid color 3
+	for i := range uint16(TILE_SIZE_IN_BYTES) {
+		mem.WritePpu(0xff, 0x0010+i)
+		mem.WritePpu(0xff, 0x0030+i)
+		mem.WritePpu(0xff, 0x0038+i)
+	}
+	mem.WritePpu(0x80, 0x0020)
+
+	mem.WritePpu(0x0f, 0x3f00)
+	mem.WritePpu(0x30, 0x3f01)
+	mem.WritePpu(0x16, 0x3f11)
+	mem.WritePpu(0x27, 0x3f13)
+	mem.WritePpu(0x2a, 0x3f17)
+
+	// Move the sprites out of the screen
+	for n := range SPRITE_COUNT {
+		setSprite(ppu, n, 0xff, 0, 0, 0)
+	}
+
+	return ppu, mem
+}
+
+func TestRenderSprites(t *testing.T) {
+	ppu, mem := newSpritesPPU(t)
+	mem.WriteCpu(MASK_SPRITES|MASK_SPRITES_LEFT, PPUMASK)
+
+	setSprite(ppu, 0, 9, 1, 0, 20)
+	setSprite(ppu, 1, 9, 3, 1, 24)
+	ppu.RenderFrame()
+
+	frame := ppu.Frame()
+	// Sprites are drawn one line below their Y
+	assert.Equal(t, SYSTEM_PALETTE[0x0f], frame.RGBAAt(20, 9))
+	assert.Equal(t, SYSTEM_PALETTE[0x16], frame.RGBAAt(20, 10))
+	assert.Equal(t, SYSTEM_PALETTE[0x16], frame.RGBAAt(27, 17))
+	assert.Equal(t, SYSTEM_PALETTE[0x0f], frame.RGBAAt(20, 18))
+	// Overlapping sprites show the one with the lowest OAM index
+	assert.Equal(t, SYSTEM_PALETTE[0x16], frame.RGBAAt(24, 10))
+	assert.Equal(t, SYSTEM_PALETTE[0x2a], frame.RGBAAt(28, 10))
+
+	// Flipping moves the single pixel of tile 2 to the other corners
+	setSprite(ppu, 0, 9, 2, SPRITE_FLIP_HORIZONTAL|SPRITE_FLIP_VERTICAL, 40)
+	ppu.RenderFrame()
+	assert.Equal(t, SYSTEM_PALETTE[0x0f], frame.RGBAAt(40, 10))
+	assert.Equal(t, SYSTEM_PALETTE[0x16], frame.RGBAAt(47, 17))
+
+	// 8x16 sprites use the next tile for the bottom half
+	mem.WriteCpu(CTRL_SPRITE_SIZE, PPUCTRL)
+	setSprite(ppu, 0, 9, 2, 0, 40)
+	ppu.RenderFrame()
+	assert.Equal(t, SYSTEM_PALETTE[0x16], frame.RGBAAt(40, 10))
+	assert.Equal(t, SYSTEM_PALETTE[0x27], frame.RGBAAt(47, 25))
+	assert.Equal(t, SYSTEM_PALETTE[0x0f], frame.RGBAAt(40, 26))
+}
+
+func TestSpritePriority(t *testing.T) {
+	ppu, mem := newSpritesPPU(t)
+	mem.WriteCpu(MASK_SPRITES|MASK_BACKGROUND, PPUMASK)
+	writePpuAddress(mem, 0x0000)
+	mem.WritePpu(0x01, 0x2021)
+
+	setSprite(ppu, 0, 7, 1, 0, 4)
+	setSprite(ppu, 1, 7, 1, SPRITE_BEHIND, 12)
+	ppu.RenderFrame()
+
+	frame := ppu.Frame()
+	// The leftmost 8 pixels are hidden
+	assert.Equal(t, SYSTEM_PALETTE[0x0f], frame.RGBAAt(4, 8))
+	assert.Equal(t, SYSTEM_PALETTE[0x16], frame.RGBAAt(8, 8))
+	assert.Equal(t, SYSTEM_PALETTE[0x30], frame.RGBAAt(12, 8))
+	assert.Equal(t, SYSTEM_PALETTE[0x16], frame.RGBAAt(16, 8))
+	assert.NotZero(t, ppu.status&STATUS_SPRITE_0_HIT)
+
+	// Without overlap there is no hit
+	setSprite(ppu, 0, 30, 1, 0, 8)
+	writePpuAddress(mem, 0x0000)
+	ppu.RenderFrame()
+	assert.Zero(t, ppu.status&STATUS_SPRITE_0_HIT)
+}
+
+func TestSpriteOverflow(t *testing.T) {
+	ppu, mem := newSpritesPPU(t)
+	mem.WriteCpu(MASK_SPRITES, PPUMASK)
+
+	for n := range SPRITES_PER_LINE {
+		setSprite(ppu, n, 20, 1, 0, byte(n*8))
+	}
+	ppu.RenderFrame()
+	assert.Zero(t, ppu.status&STATUS_SPRITE_OVERFLOW)
+
+	// Only 8 sprites are drawn per line
+	setSprite(ppu, 8, 20, 1, 0, 100)
+	ppu.RenderFrame()
+	assert.NotZero(t, ppu.status&STATUS_SPRITE_OVERFLOW)
+	assert.Equal(t, SYSTEM_PALETTE[0x0f], ppu.Frame().RGBAAt(100, 21))
+
+	// After the eighth sprite the tile index of the next entry is read as a Y
+	setSprite(ppu, 8, 0xff, 0, 0, 0)
+	setSprite(ppu, 9, 0xff, 20, 0, 0)
+	ppu.RenderFrame()
+	assert.NotZero(t, ppu.status&STATUS_SPRITE_OVERFLOW)
+}
+
+func TestOamDma(t *testing.T) {
+	ppu, mem := newTestPPU(t)
+	for i := range uint16(OAM_SIZE) {
+		mem.WriteCpu(byte(i), 0x0200+i)
+	}
+
+	mem.WriteCpu(0x10, OAMADDR)
+	mem.WriteCpu(0x02, OAMDMA)
+	assert.Equal(t, byte(0x00), ppu.oam[0x10])
+	assert.Equal(t, byte(0xff), ppu.oam[0x0f])
+	assert.Equal(t, uint64(OAM_DMA_CYCLES), mem.StallCycles)
+
+	// Starting on an odd cycle takes an extra one
+	mem.StallCycles = 0
+	mem.CpuCycle = 1
+	mem.WriteCpu(0x02, OAMDMA)
+	assert.Equal(t, uint64(OAM_DMA_CYCLES+1), mem.StallCycles)
+}
+
+// Ticks until the PPU is about to run the given dot
+func tickTo(ppu *PPU, scanline, dot int) {
+	for ppu.scanline != scanline || ppu.dot != dot {
+		ppu.Tick()
+	}
+}
+
+func TestVblank(t *testing.T) {
+	ppu, mem := newTestPPU(t)
+	mem.WriteCpu(CTRL_NMI, PPUCTRL)
+
+	tickTo(ppu, VBLANK_SCANLINE, 1)
+	assert.Zero(t, ppu.status&STATUS_VBLANK)
+	ppu.Tick()
+	assert.NotZero(t, ppu.status&STATUS_VBLANK)
+	assert.True(t, ppu.NMI())
+
+	// Disabling NMIs in PPUCTRL lowers the line
+	mem.WriteCpu(0x00, PPUCTRL)
+	assert.False(t, ppu.NMI())
+	mem.WriteCpu(CTRL_NMI, PPUCTRL)
+	assert.True(t, ppu.NMI())
+
+	// Reading PPUSTATUS acknowledges it
+	val, _ := mem.ReadCpu(PPUSTATUS)
+	assert.NotZero(t, val&STATUS_VBLANK)
+	assert.False(t, ppu.NMI())
+
+	ppu.status |= STATUS_VBLANK | STATUS_SPRITE_0_HIT
+	tickTo(ppu, PRE_RENDER_SCANLINE, 2)
+	assert.Zero(t, ppu.status)
+}
+
+func TestVblankRace(t *testing.T) {
+	ppu, mem := newTestPPU(t)
+	mem.WriteCpu(CTRL_NMI, PPUCTRL)
+
+	tickTo(ppu, VBLANK_SCANLINE, 1)
+	val, _ := mem.ReadCpu(PPUSTATUS)
+	assert.Zero(t, val&STATUS_VBLANK)
+
+	tickTo(ppu, VBLANK_SCANLINE+1, 0)
+	assert.Zero(t, ppu.status&STATUS_VBLANK)
+	assert.False(t, ppu.NMI())
+
+	// Only that frame is affected
+	tickTo(ppu, PRE_RENDER_SCANLINE, 0)
+	tickTo(ppu, VBLANK_SCANLINE+1, 0)
+	assert.True(t, ppu.NMI())
+}
+
+func TestRegistersCatchUp(t *testing.T) {
+	for dot, expected := range []struct {
+		status bool
+		vblank bool
+	}{
+		// Before the flag is set, and just before, which also keeps it
+		// from being set in this frame
+		{false, true},
+		{false, false},
+		// After it's set, which acknowledges it
+		{true, false},
+	} {
+		ppu, mem := newTestPPU(t)
+		tickTo(ppu, SCREEN_HEIGHT, 0)
+
+		// The PPU is behind the CPU, as it is in the middle of an instruction
+		mem.CpuCycle = 1000
+		ppu.cycles = mem.CpuCycle*DOTS_PER_CPU_CYCLE - uint64(DOTS_PER_SCANLINE+dot)
+
+		val, _ := mem.ReadCpu(PPUSTATUS)
+		assert.Equal(t, VBLANK_SCANLINE, ppu.scanline)
+		assert.Equal(t, dot, ppu.dot)
+		assert.Equal(t, expected.status, val&STATUS_VBLANK != 0, "dot %v", dot)
+
+		tickTo(ppu, VBLANK_SCANLINE+1, 0)
+		assert.Equal(t, expected.vblank, ppu.status&STATUS_VBLANK != 0, "dot %v", dot)
+	}
+}
+
+func TestOddFrames(t *testing.T) {
+	ppu, mem := newTestPPU(t)
+	frameDots := uint64(DOTS_PER_SCANLINE * SCANLINES_PER_FRAME)
+
+	tickTo(ppu, SCREEN_HEIGHT, 0)
+	start := ppu.cycles
+	ppu.RenderFrame()
+	ppu.RenderFrame()
+	assert.Equal(t, start+2*frameDots, ppu.cycles)
+
+	// With rendering enabled odd frames are one dot shorter
+	mem.WriteCpu(MASK_BACKGROUND, PPUMASK)
+	start = ppu.cycles
+	ppu.RenderFrame()
+	ppu.RenderFrame()
+	assert.Equal(t, start+2*frameDots-1, ppu.cycles)
+	assert.Equal(t, uint64(5), ppu.FrameCount())
+}
+
+func TestCatchUp(t *testing.T) {
+	ppu, _ := newTestPPU(t)
+
+	ppu.CatchUp(10)
+	assert.Equal(t, uint64(10*DOTS_PER_CPU_CYCLE), ppu.cycles)
+	assert.Equal(t, 10*DOTS_PER_CPU_CYCLE, ppu.dot)
+}
+
+func TestSprite0HitDot(t *testing.T) {
+	ppu, mem := newSpritesPPU(t)
+	mem.WriteCpu(MASK_SPRITES|MASK_BACKGROUND, PPUMASK)
+	mem.WritePpu(0x01, 0x2021)
+	setSprite(ppu, 0, 7, 1, 0, 12)
+	ppu.RenderFrame()
+	ppu.RenderFrame()
+
+	tickTo(ppu, 8, 13)
+	assert.Zero(t, ppu.status&STATUS_SPRITE_0_HIT)
+	ppu.Tick()
+	assert.NotZero(t, ppu.status&STATUS_SPRITE_0_HIT)
+}
+
+func TestMMC3ScanlineIrq(t *testing.T) {
+	cartridge := make([]byte, emulator.HEADER_SIZE+emulator.PRG_BYTES_UNITS*emulator.BYTES_IN_KILOBYTES)
+	copy(cartridge, emulator.INES_MAGIC)
+	cartridge[4] = 1
+	cartridge[6] = 0x40
+
+	rom, err := emulator.NewRom(cartridge)
+	assert.Nil(t, err)
+	mem, err := emulator.NewMemory(rom)
+	assert.Nil(t, err)
+	ppu := NewPPU(mem)
+
+	// Only the sprites are shown, from $1000, but the background is still
+	// fetched from $0000, giving one A12 rising edge per line
+	mem.WriteCpu(CTRL_SPRITE_TABLE, PPUCTRL)
+	mem.WriteCpu(MASK_SPRITES, PPUMASK)
+	mem.WriteCpu(10, 0xc000)
+	mem.WriteCpu(0, 0xc001)
+	mem.WriteCpu(0, 0xe001)
+
+	// Reloaded on the pre-render line, then clocked by lines 0 to 9
+	for !mem.Mapper.IRQ() {
+		ppu.Tick()
+	}
+	assert.Equal(t, 9, ppu.Scanline())
+	assert.Equal(t, SPRITE_FETCH_DOT+1, ppu.dot)
+}
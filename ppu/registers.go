@@ -0,0 +1,147 @@
+package ppu
+
+import (
+	"nes-go/emulator"
+)
+
+// PPUCTRL flags
+const (
+	CTRL_NAMETABLE        byte = 0x03
+	CTRL_INCREMENT        byte = 0x04
+	CTRL_SPRITE_TABLE     byte = 0x08
+	CTRL_BACKGROUND_TABLE byte = 0x10
+	CTRL_SPRITE_SIZE      byte = 0x20
+	CTRL_NMI              byte = 0x80
+)
+
+// PPUMASK flags
+const (
+	MASK_GRAYSCALE       byte = 0x01
+	MASK_BACKGROUND_LEFT byte = 0x02
+	MASK_SPRITES_LEFT    byte = 0x04
+	MASK_BACKGROUND      byte = 0x08
+	MASK_SPRITES         byte = 0x10
+)
+
+// PPUSTATUS flags, the lower 5 bits are open bus
+const (
+	STATUS_SPRITE_OVERFLOW byte = 0x20
+	STATUS_SPRITE_0_HIT    byte = 0x40
+	STATUS_VBLANK          byte = 0x80
+	STATUS_FLAGS           byte = 0xe0
+)
+
+const (
+	PPU_ADDR_MASK = 0x3fff
+
+	VRAM_INCREMENT_ACROSS = 1
+	VRAM_INCREMENT_DOWN   = 32
+)
+
+/*
+* Loopy registers, v and t share this layout:
+*	yyy NN YYYYY XXXXX
+*	||| || ||||| +++++-- coarse X scroll
+*	||| || +++++-------- coarse Y scroll
+*	||| ++-------------- nametable select
+*	+++----------------- fine Y scroll
+ */
+const (
+	LOOPY_COARSE_X  uint16 = 0x001f
+	LOOPY_COARSE_Y  uint16 = 0x03e0
+	LOOPY_NAMETABLE uint16 = 0x0c00
+	LOOPY_FINE_Y    uint16 = 0x7000
+)
+
+func (ppu *PPU) vramIncrement() uint16 {
+	if ppu.ctrl&CTRL_INCREMENT != 0 {
+		return VRAM_INCREMENT_DOWN
+	}
+
+	return VRAM_INCREMENT_ACROSS
+}
+
+// Read of a PPU register from the CPU bus, the mirrors are already resolved.
+// The PPU first catches up with the CPU, so the read sees the current dot
+func (ppu *PPU) Read(address uint16) byte {
+	ppu.CatchUp(ppu.mem.CpuCycle)
+
+	switch address {
+	case PPUSTATUS:
+		// Reading just before vblank starts returns the flag clear and keeps
+		// it from being set, so no NMI happens in that frame
+		if ppu.scanline == VBLANK_SCANLINE && ppu.dot == 1 {
+			ppu.suppressVblank = true
+		}
+		ppu.latch = ppu.status&STATUS_FLAGS | ppu.latch&^STATUS_FLAGS
+		ppu.status &^= STATUS_VBLANK
+		ppu.w = false
+	case OAMDATA:
+		ppu.latch = ppu.oam[ppu.oamAddr]
+	case PPUDATA:
+		ppu.latch = ppu.readData()
+	}
+
+	// Write only registers return the last value seen by the PPU bus
+	return ppu.latch
+}
+
+// Write to a PPU register from the CPU bus, the mirrors are already resolved
+func (ppu *PPU) Write(value byte, address uint16) {
+	ppu.CatchUp(ppu.mem.CpuCycle)
+	ppu.latch = value
+
+	switch address {
+	case PPUCTRL:
+		ppu.ctrl = value
+		ppu.t = ppu.t&^LOOPY_NAMETABLE | uint16(value&CTRL_NAMETABLE)<<10
+	case PPUMASK:
+		ppu.mask = value
+	case OAMADDR:
+		ppu.oamAddr = value
+	case OAMDATA:
+		ppu.oam[ppu.oamAddr] = value
+		ppu.oamAddr++
+	case PPUSCROLL:
+		if !ppu.w {
+			ppu.t = ppu.t&^LOOPY_COARSE_X | uint16(value>>3)
+			ppu.x = value & 0x07
+		} else {
+			ppu.t = ppu.t&^(LOOPY_COARSE_Y|LOOPY_FINE_Y) | uint16(value>>3)<<5 | uint16(value&0x07)<<12
+		}
+		ppu.w = !ppu.w
+	case PPUADDR:
+		if !ppu.w {
+			// The highest bit of t is cleared, addresses are only 14 bits wide
+			ppu.t = ppu.t&0x00ff | uint16(value&0x3f)<<8
+		} else {
+			ppu.t = ppu.t&0xff00 | uint16(value)
+			ppu.v = ppu.t
+		}
+		ppu.w = !ppu.w
+	case PPUDATA:
+		ppu.mem.WritePpu(value, ppu.v&PPU_ADDR_MASK)
+		ppu.v += ppu.vramIncrement()
+	case OAMDMA:
+		ppu.oamDma(value)
+	}
+}
+
+// PPUDATA reads are delayed by one read, except for the palette, which
+// returns the value directly and fills the buffer with the nametable below it
+func (ppu *PPU) readData() byte {
+	address := ppu.v & PPU_ADDR_MASK
+	ppu.v += ppu.vramIncrement()
+
+	if address < emulator.PALETTE_START {
+		val := ppu.readBuffer
+		ppu.readBuffer, _ = ppu.mem.ReadPpu(address)
+		return val
+	}
+
+	ppu.readBuffer, _ = ppu.mem.ReadPpu(address - 0x1000)
+	val, _ := ppu.mem.ReadPpu(address)
+
+	// Palette entries are 6 bits wide, the upper ones are open bus
+	return val&0x3f | ppu.latch&0xc0
+}
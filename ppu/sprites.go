@@ -0,0 +1,203 @@
+package ppu
+
+const (
+	SPRITES_PER_LINE = 8
+	SPRITE_COUNT     = 64
+	SPRITE_SIZE      = 4
+	SPRITE_WIDTH     = 8
+	SPRITE_HEIGHT    = 8
+	SPRITE_HEIGHT_16 = 16
+
+	// Sprites use the last 4 palettes
+	SPRITE_PALETTES = 0x10
+
+	OAM_DMA_CYCLES = 513
+)
+
+// Sprite attributes, the third byte of each OAM entry
+const (
+	SPRITE_PALETTE         byte = 0x03
+	SPRITE_BEHIND          byte = 0x20
+	SPRITE_FLIP_HORIZONTAL byte = 0x40
+	SPRITE_FLIP_VERTICAL   byte = 0x80
+)
+
+/*
+* OAM entries:
+*	Byte 0 	Y position of the top of the sprite, minus 1
+*	Byte 1 	Tile index
+*	Byte 2 	Attributes
+*	Byte 3 	X position of the left side of the sprite
+ */
+type spritePixel struct {
+	// Palette RAM index, 0 when transparent
+	color  byte
+	behind bool
+	zero   bool
+}
+
+// Copies a page of CPU memory to the OAM, starting at OAMADDR like writes to
+// OAMDATA do. The CPU is halted during the transfer, an extra cycle is
+// needed to align with the write cycles when it starts on an odd cycle
+func (ppu *PPU) oamDma(page byte) {
+	start := uint16(page) << 8
+	for i := range uint16(OAM_SIZE) {
+		val, _ := ppu.mem.ReadCpu(start + i)
+		ppu.oam[ppu.oamAddr] = val
+		ppu.oamAddr++
+	}
+
+	ppu.mem.StallCycles += OAM_DMA_CYCLES + ppu.mem.CpuCycle%2
+}
+
+func (ppu *PPU) spriteHeight() int {
+	if ppu.ctrl&CTRL_SPRITE_SIZE != 0 {
+		return SPRITE_HEIGHT_16
+	}
+
+	return SPRITE_HEIGHT
+}
+
+func (ppu *PPU) spriteInRange(y byte, line int) bool {
+	row := line - int(y)
+	return row >= 0 && row < ppu.spriteHeight()
+}
+
+// Finds the first 8 sprites of the OAM that are in the given line. After the
+// eighth one the hardware also increments the byte index inside each entry,
+// so the overflow flag is set by comparing tile indexes, attributes or X
+// positions as if they were Y coordinates
+func (ppu *PPU) evaluateSprites(line int) {
+	ppu.lineSpriteCount = 0
+
+	n := 0
+	for ; n < SPRITE_COUNT && ppu.lineSpriteCount < SPRITES_PER_LINE; n++ {
+		if ppu.spriteInRange(ppu.oam[n*SPRITE_SIZE], line) {
+			ppu.lineSprites[ppu.lineSpriteCount] = byte(n)
+			ppu.lineSpriteCount++
+		}
+	}
+
+	m := 0
+	for ; n < SPRITE_COUNT; n++ {
+		if ppu.spriteInRange(ppu.oam[n*SPRITE_SIZE+m], line) {
+			ppu.status |= STATUS_SPRITE_OVERFLOW
+			return
+		}
+		m = (m + 1) % SPRITE_SIZE
+	}
+}
+
+// Address of the pattern row of a sprite, with the vertical flip applied
+func (ppu *PPU) spritePatternAddress(tile, attributes byte, row int) uint16 {
+	height := ppu.spriteHeight()
+	if attributes&SPRITE_FLIP_VERTICAL != 0 {
+		row = height - 1 - row
+	}
+
+	if height == SPRITE_HEIGHT {
+		table := uint16(PATTERN_TABLE_0_ADDRESS)
+		if ppu.ctrl&CTRL_SPRITE_TABLE != 0 {
+			table = PATTERN_TABLE_1_ADDRESS
+		}
+		return table + uint16(tile)*TILE_SIZE_IN_BYTES*2 + uint16(row)
+	}
+
+	// 8x16 sprites take the table from the lowest bit of the tile
+	// and are made of two consecutive tiles
+	table := uint16(tile&1) * PATTERN_TABLE_1_ADDRESS
+	tile &^= 1
+	if row >= SPRITE_HEIGHT {
+		tile++
+		row -= SPRITE_HEIGHT
+	}
+
+	return table + uint16(tile)*TILE_SIZE_IN_BYTES*2 + uint16(row)
+}
+
+// Fetches the patterns of the sprites found for the line into spritePixels,
+// to be drawn on the next one as sprite Y positions are one less than the
+// line they appear on. Empty slots still fetch tile $FF, which some mappers
+// rely on to count lines
+func (ppu *PPU) renderSprites(line int) {
+	clear(ppu.spritePixels[:])
+
+	for slot := range SPRITES_PER_LINE {
+		if slot >= ppu.lineSpriteCount {
+			address := ppu.spritePatternAddress(0xff, 0, 0)
+			ppu.mem.ReadPpu(address)
+			ppu.mem.ReadPpu(address + TILE_SIZE_IN_BYTES)
+			continue
+		}
+
+		n := int(ppu.lineSprites[slot])
+		entry := ppu.oam[n*SPRITE_SIZE : (n+1)*SPRITE_SIZE]
+		y, tile, attributes, x := entry[0], entry[1], entry[2], int(entry[3])
+
+		address := ppu.spritePatternAddress(tile, attributes, line-int(y))
+		plane0, _ := ppu.mem.ReadPpu(address)
+		plane1, _ := ppu.mem.ReadPpu(address + TILE_SIZE_IN_BYTES)
+
+		if ppu.mask&MASK_SPRITES == 0 {
+			continue
+		}
+
+		for col := range SPRITE_WIDTH {
+			px := x + col
+			if px >= SCREEN_WIDTH {
+				break
+			}
+
+			// Lower OAM indexes have priority over the rest
+			if ppu.spritePixels[px].color != 0 {
+				continue
+			}
+
+			if px < TILE_SIZE_IN_BYTES && ppu.mask&MASK_SPRITES_LEFT == 0 {
+				continue
+			}
+
+			bit := 7 - col
+			if attributes&SPRITE_FLIP_HORIZONTAL != 0 {
+				bit = col
+			}
+
+			pixel := (plane0>>bit)&1 | ((plane1>>bit)&1)<<1
+			if pixel == 0 {
+				continue
+			}
+
+			ppu.spritePixels[px] = spritePixel{
+				color:  SPRITE_PALETTES + (attributes&SPRITE_PALETTE)*PALETTE_ENTRIES + pixel,
+				behind: attributes&SPRITE_BEHIND != 0,
+				zero:   n == 0,
+			}
+		}
+	}
+}
+
+// Picks between the background and the sprite for a pixel of the line,
+// scheduling the sprite 0 hit when both are opaque
+func (ppu *PPU) composePixel(x int) byte {
+	bg := ppu.bgPixels[x]
+	sprite := ppu.spritePixels[x]
+
+	if sprite.color == 0 {
+		return bg
+	}
+
+	if bg == 0 {
+		return sprite.color
+	}
+
+	// The hit is never detected at the last pixel
+	if sprite.zero && x != SCREEN_WIDTH-1 && ppu.sprite0HitDot == 0 {
+		ppu.sprite0HitDot = x + 1
+	}
+
+	if sprite.behind {
+		return bg
+	}
+
+	return sprite.color
+}
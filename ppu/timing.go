@@ -0,0 +1,139 @@
+package ppu
+
+/*
+* NTSC frame timing, 341 dots per scanline:
+*	Scanlines 0-239 	Visible
+*	Scanline 240    	Post-render, idle
+*	Scanlines 241-260 	Vertical blank, the flag is set on dot 1 of 241
+*	Scanline 261    	Pre-render, clears the flags and reloads the scroll
+*
+* Odd frames skip the last dot of the pre-render line when rendering is enabled
+ */
+const (
+	DOTS_PER_SCANLINE   = 341
+	SCANLINES_PER_FRAME = 262
+	VBLANK_SCANLINE     = 241
+	PRE_RENDER_SCANLINE = 261
+
+	DOTS_PER_CPU_CYCLE = 3
+
+	// Dots where the loopy registers are updated and the sprites fetched
+	INCREMENT_Y_DOT  = 256
+	SPRITE_FETCH_DOT = 257
+	COPY_Y_DOT       = 280
+)
+
+// Advances the PPU one dot
+func (ppu *PPU) Tick() {
+	ppu.mem.PpuCycle = ppu.cycles
+	rendering := ppu.renderingEnabled()
+
+	switch {
+	case ppu.scanline < SCREEN_HEIGHT:
+		ppu.visibleDot(rendering)
+	case ppu.scanline == VBLANK_SCANLINE && ppu.dot == 1:
+		if !ppu.suppressVblank {
+			ppu.status |= STATUS_VBLANK
+		}
+		ppu.suppressVblank = false
+	case ppu.scanline == PRE_RENDER_SCANLINE:
+		ppu.preRenderDot(rendering)
+	}
+
+	ppu.cycles++
+	ppu.dot++
+
+	if ppu.scanline == PRE_RENDER_SCANLINE && ppu.dot == DOTS_PER_SCANLINE-1 && ppu.oddFrame && rendering {
+		ppu.dot = DOTS_PER_SCANLINE
+	}
+
+	if ppu.dot == DOTS_PER_SCANLINE {
+		ppu.dot = 0
+		ppu.scanline++
+
+		switch ppu.scanline {
+		case SCREEN_HEIGHT:
+			ppu.frameCount++
+		case SCANLINES_PER_FRAME:
+			ppu.scanline = 0
+			ppu.oddFrame = !ppu.oddFrame
+		}
+	}
+}
+
+func (ppu *PPU) visibleDot(rendering bool) {
+	switch ppu.dot {
+	case 1:
+		ppu.sprite0HitDot = 0
+		ppu.renderScanline(ppu.scanline)
+	case INCREMENT_Y_DOT:
+		if rendering {
+			ppu.incrementY()
+		}
+	case SPRITE_FETCH_DOT:
+		if rendering {
+			ppu.copyX()
+			ppu.evaluateSprites(ppu.scanline)
+			ppu.renderSprites(ppu.scanline)
+		} else {
+			clear(ppu.spritePixels[:])
+		}
+	}
+
+	// The hit is found when the line is drawn but only flagged on its dot
+	if ppu.sprite0HitDot != 0 && ppu.dot == ppu.sprite0HitDot {
+		ppu.status |= STATUS_SPRITE_0_HIT
+	}
+}
+
+func (ppu *PPU) preRenderDot(rendering bool) {
+	switch ppu.dot {
+	case 1:
+		ppu.status &^= STATUS_VBLANK | STATUS_SPRITE_0_HIT | STATUS_SPRITE_OVERFLOW
+		if rendering {
+			ppu.fetchBackgroundTile()
+		}
+	case SPRITE_FETCH_DOT:
+		clear(ppu.spritePixels[:])
+		if rendering {
+			ppu.copyX()
+			// No sprites are drawn on line 0, but the fetches still happen
+			ppu.lineSpriteCount = 0
+			ppu.renderSprites(ppu.scanline)
+		}
+	case COPY_Y_DOT:
+		if rendering {
+			ppu.copyY()
+		}
+	}
+}
+
+// The NMI output of the PPU, active during vblank when enabled in PPUCTRL
+func (ppu *PPU) NMI() bool {
+	return ppu.ctrl&CTRL_NMI != 0 && ppu.status&STATUS_VBLANK != 0
+}
+
+// Runs the PPU until it catches up with the given CPU cycle
+func (ppu *PPU) CatchUp(cpuCycle uint64) {
+	for ppu.cycles < cpuCycle*DOTS_PER_CPU_CYCLE {
+		ppu.Tick()
+	}
+}
+
+// Scanline being drawn, PRE_RENDER_SCANLINE before the first visible one
+func (ppu *PPU) Scanline() int {
+	return ppu.scanline
+}
+
+// Number of frames completely drawn into the frame buffer
+func (ppu *PPU) FrameCount() uint64 {
+	return ppu.frameCount
+}
+
+// Runs the PPU until the next frame has been drawn
+func (ppu *PPU) RenderFrame() {
+	frame := ppu.frameCount
+	for ppu.frameCount == frame {
+		ppu.Tick()
+	}
+}